@@ -2,7 +2,6 @@ package api
 
 import (
 	"fmt"
-	"log"
 	"moneropot/db"
 	"moneropot/util"
 	"net/http"
@@ -35,10 +34,14 @@ func (s *Server) handlePostAccount() http.HandlerFunc {
 		if err := s.bind(r, &req); err != nil {
 			return err
 		}
-		if db.IsValidAddress(req.Address) != nil {
+		if db.IsValidAddress(r.Context(), req.Address) != nil {
 			return newValidationErr("address", "invalid")
 		}
-		acct, err := db.GetAccount(req.Address, req.UserName, req.Referrer)
+		pot, err := s.getPot(r)
+		if err != nil {
+			return err
+		}
+		acct, err := db.GetAccount(r.Context(), pot, req.Address, req.UserName, req.Referrer)
 		if err != nil {
 			if err == db.ErrDuplicateUser {
 				return newValidationErr("username", "exists")
@@ -60,7 +63,7 @@ func (s *Server) handlePostAccount() http.HandlerFunc {
 		if err != nil {
 			return err
 		}
-		uri, err := acct.AddressUri(db.CurrentPrice)
+		uri, err := acct.AddressUri(r.Context(), db.CurrentPrice)
 		if err != nil {
 			return err
 		}
@@ -72,59 +75,77 @@ func (s *Server) handlePostAccount() http.HandlerFunc {
 
 func (s *Server) handleGetInfo() http.HandlerFunc {
 	type response struct {
-		WinAmount         string         `json:"win_amount"`
-		AffiliateAmount   string         `json:"ref_amount"`
-		MaintenanceAmount string         `json:"maint_amount"`
-		FundAmount        string         `json:"fund_amount"`
-		EntryPrice        string         `json:"entry_price"`
-		XmrRate           string         `json:"xmr_rate"`
-		TotalEntries      int64          `json:"entries"`
-		UntilDraw         int64          `json:"until_draw"`
-		UntilPrice        int64          `json:"until_price"`
-		WalletAddress     string         `json:"address"`
-		WalletOffline     bool           `json:"wallet_offline"`
-		SignKey           string         `json:"sign_key"`
-		LastWinner        *db.WinnerInfo `json:"last_winner"`
+		WinAmount         string           `json:"win_amount"`
+		AffiliateAmount   string           `json:"ref_amount"`
+		MaintenanceAmount string           `json:"maint_amount"`
+		FundAmount        string           `json:"fund_amount"`
+		EntryPrice        string           `json:"entry_price"`
+		TicketPrice       float64          `json:"ticket_price,omitempty"`
+		Currency          string           `json:"currency,omitempty"`
+		FiatRate          string           `json:"fiat_rate,omitempty"`
+		XmrRate           string           `json:"xmr_rate,omitempty"`
+		TotalEntries      int64            `json:"entries"`
+		Pot               *db.Pot          `json:"pot"`
+		Schedule          map[string]int64 `json:"schedule"`
+		Daemon            string           `json:"daemon"`
+		WalletAddress     string           `json:"address"`
+		WalletOffline     bool             `json:"wallet_offline"`
+		SignKey           string           `json:"sign_key"`
+		SignCommit        string           `json:"sign_commit"`
+		Algorithm         string           `json:"algorithm"`
+		LastWinner        *db.WinnerInfo   `json:"last_winner"`
+		Split             util.Split       `json:"split"`
 	}
 	return s.handler(func(r *http.Request) interface{} {
 		var resp response
-		cKey := "info"
+		pot, err := s.getPot(r)
+		if err != nil {
+			return err
+		}
+		cKey := db.InfoCacheKey(pot.ID)
 		item, ok := util.Cache.Get(cKey)
 		if !ok {
-			// load sync first time then refresh on background on demand
-			if util.XmrPrice == 0 {
-				util.XmrToUSD(false)
-			} else {
-				go func() {
-					util.XmrToUSD(false)
-				}()
-			}
 			resp = response{}
-			rate := util.XmrPrice
+			resp.Split = util.Config.Split
 			resp.EntryPrice = monerorpc.XMRToDecimal(db.CurrentPrice)
-			resp.XmrRate = util.USDToDecimal(rate)
-			resp.UntilDraw = int64(db.StartOfMonth().Seconds())
-			resp.UntilPrice = int64(db.AtHourMinute(3, 0).Seconds())
-			entries, err := db.TotalEntries()
+			// a fixed entry price has no fiat fields
+			if !util.FixedPrice() {
+				// load sync first time then refresh on background on demand
+				if util.XmrPrice == 0 {
+					util.XmrToFiat(false)
+				} else {
+					go func() {
+						util.XmrToFiat(false)
+					}()
+				}
+				// xmr_rate is the fiat rate as well, older clients read it as USD which it is by default
+				resp.FiatRate = util.FiatToDecimal(util.XmrPrice)
+				resp.XmrRate = resp.FiatRate
+				resp.Currency = util.FiatCurrency()
+				resp.TicketPrice = util.Config.TicketPrice
+			}
+			resp.Pot = pot
+			entries, err := db.TotalEntries(pot.ID)
 			if err != nil {
 				return err
 			}
 			resp.TotalEntries = entries
-			signKey, err := db.GetMetadata("sign_key", "")
-			if err != nil {
-				return err
+			resp.SignCommit = pot.SignCommit
+			resp.Algorithm = pot.DrawAlgorithm
+			if pot.SignCommit == "" {
+				// legacy round signed with the previous block, nothing to hide
+				resp.SignKey = pot.SignKey
 			}
-			resp.SignKey = signKey
-			lastWinner, err := db.GetWinner("")
+			lastWinner, err := db.GetWinner(pot.ID, "")
 			if err != nil {
 				return err
 			}
 			resp.LastWinner = lastWinner
 			// wallet calls
-			amt, err := db.GetDistributedAmounts(false)
+			amt, err := db.GetDistributedAmounts(r.Context(), pot, false)
 			if err != nil {
 				resp.WalletOffline = true
-				log.Println("WalletOffline:", err)
+				s.log(r).Warn("wallet offline", "pot_id", pot.ID, "error", err)
 			} else {
 				resp.WinAmount = monerorpc.XMRToDecimal(amt.Winner)
 				resp.AffiliateAmount = monerorpc.XMRToDecimal(amt.Referrals)
@@ -137,7 +158,7 @@ func (s *Server) handleGetInfo() http.HandlerFunc {
 				resp.WalletAddress = addr
 			} else {
 				resp.WalletOffline = true
-				log.Println("WalletOffline:", address)
+				s.log(r).Warn("wallet offline", "pot_id", pot.ID, "error", address)
 			}
 			// end wallet calls
 			d := time.Minute * 5
@@ -148,16 +169,28 @@ func (s *Server) handleGetInfo() http.HandlerFunc {
 		} else {
 			resp = item.(response)
 		}
+		// seconds until each job runs next, not cached since it counts down
+		resp.Schedule = map[string]int64{"draw": untilSeconds(pot.NextDraw())}
+		for _, name := range []string{db.CronPrice, db.CronMissedTransfers, db.CronBackup, db.CronPayouts} {
+			resp.Schedule[name] = untilSeconds(db.NextRun(name))
+		}
+		resp.Daemon = db.ActiveDaemon()
 		return resp
 	})
 }
 
+func untilSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return int64(time.Until(t).Seconds())
+}
+
 func (s *Server) handleGetEntries() http.HandlerFunc {
 	return s.handler(func(r *http.Request) interface{} {
 		var (
 			aID     int64
 			entries []db.Entry
-			err     error
 		)
 		page := 1
 		acctId := r.URL.Query()["a"]
@@ -171,10 +204,14 @@ func (s *Server) handleGetEntries() http.HandlerFunc {
 		if page < 1 {
 			page = 1
 		}
-		cKey := fmt.Sprintf("entries:%d:%d", aID, page)
+		pot, err := s.getPot(r)
+		if err != nil {
+			return err
+		}
+		cKey := fmt.Sprintf("entries:%d:%d:%d", pot.ID, aID, page)
 		item, ok := util.Cache.Get(cKey)
 		if !ok {
-			entries, err = db.GetEntries(aID, page)
+			entries, err = db.GetEntries(pot.ID, aID, page)
 			if err != nil {
 				return err
 			}
@@ -189,3 +226,57 @@ func (s *Server) handleGetEntries() http.HandlerFunc {
 		return entries
 	})
 }
+
+func (s *Server) handleGetPots() http.HandlerFunc {
+	return s.handler(func(r *http.Request) interface{} {
+		pots, err := db.GetPots()
+		if err != nil {
+			return err
+		}
+		return pots
+	})
+}
+
+// handleGetPayouts lets winners look up the tx hash and tx key of their payouts for a proof of payment
+func (s *Server) handleGetPayouts() http.HandlerFunc {
+	return s.handler(func(r *http.Request) interface{} {
+		address := s.QueryParam(r, "address")
+		if len(address) != 95 {
+			return newValidationErr("address", "invalid")
+		}
+		pot, err := s.getPot(r)
+		if err != nil {
+			return err
+		}
+		payouts, err := db.GetPayouts(pot.ID, address)
+		if err != nil {
+			return err
+		}
+		return payouts
+	})
+}
+
+// handleGetPayments is the payment history of an account, ?a=account id&address=its deposit address,
+// with the entry price each payment was credited at and the entries it bought
+func (s *Server) handleGetPayments() http.HandlerFunc {
+	return s.handler(func(r *http.Request) interface{} {
+		aID, _ := strconv.ParseInt(s.QueryParam(r, "a"), 10, 64)
+		if aID < 1 {
+			return newValidationErr("a", "invalid")
+		}
+		address := s.QueryParam(r, "address")
+		if len(address) != 95 {
+			return newValidationErr("address", "invalid")
+		}
+		page, _ := strconv.Atoi(s.QueryParam(r, "p"))
+		pot, err := s.getPot(r)
+		if err != nil {
+			return err
+		}
+		txs, err := db.GetTransactions(pot.ID, aID, address, page)
+		if err != nil {
+			return err
+		}
+		return txs
+	})
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"moneropot/db"
+	"moneropot/util"
+	"net/http"
+)
+
+// handleHealth is /healthz when only the database is checked and /readyz with ready,
+// both answer 503 when a check fails
+func (s *Server) handleHealth(ready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := db.CheckHealth(ready)
+		status := http.StatusOK
+		if h.Status != db.HealthOK {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		s.writeJSONStatus(w, status, h)
+	}
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	util.WriteMetrics(w)
+}
@@ -3,36 +3,104 @@ package api
 import (
 	"fmt"
 	"moneropot/db"
+	"moneropot/monerorpc"
 	"moneropot/util"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	qrcode "github.com/skip2/go-qrcode"
 )
 
 var (
-	walletAddress string
+	walletAddress     = make(map[int64]string)
+	walletAddressLock sync.Mutex
 )
 
 func (s *Server) GetWalletAddress(r *http.Request) interface{} {
-	if walletAddress == "" {
-		address, err := db.GetWalletAddress()
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	walletAddressLock.Lock()
+	defer walletAddressLock.Unlock()
+	if walletAddress[pot.ID] == "" {
+		address, err := db.GetWalletAddress(r.Context(), pot.AccountIndex)
 		if err != nil {
 			return err
 		}
-		walletAddress = address
+		walletAddress[pot.ID] = address
 	}
-	return walletAddress
+	return walletAddress[pot.ID]
 }
 
 func (s *Server) RunPickWinner(r *http.Request) interface{} {
 	if !s.isAdmin(r) {
 		return errAuth
 	}
-	db.RunPickWinnerManually()
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	if err := db.RunPickWinnerManually(pot.ID); err != nil {
+		return err
+	}
 	return "OK"
 }
 
+// DrawAlgorithm sets the algorithm of the pot from its next round, the current round keeps its own
+func (s *Server) DrawAlgorithm(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	if err := pot.SetDrawAlgorithm(s.QueryParam(r, "algorithm")); err != nil {
+		return newValidationErr("algorithm", "invalid")
+	}
+	return "OK"
+}
+
+func (s *Server) PotSchedule(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	schedule := s.QueryParam(r, "schedule")
+	if _, err := db.ParseSchedule(schedule); err != nil {
+		return newValidationErr("schedule", "invalid")
+	}
+	if err := pot.SetSchedule(schedule); err != nil {
+		return err
+	}
+	return "OK"
+}
+
+func (s *Server) CreatePot(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	name := s.QueryParam(r, "name")
+	if name == "" {
+		return newValidationErr("name", "required")
+	}
+	schedule := s.QueryParam(r, "schedule")
+	if _, err := db.ParseSchedule(schedule); err != nil {
+		return newValidationErr("schedule", "invalid")
+	}
+	pot, err := db.CreatePot(name, schedule)
+	if err != nil {
+		return err
+	}
+	return pot
+}
+
 func (s *Server) Contact(r *http.Request) interface{} {
 	type request struct {
 		Contact string `json:"contact"`
@@ -61,7 +129,11 @@ func (s *Server) FlushWinPayload(r *http.Request) interface{} {
 	if m == "" {
 		return errNotFound
 	}
-	return db.FlushWinPayload(m)
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	return db.FlushWinPayload(pot.ID, m)
 }
 
 func (s *Server) QrCode(r *http.Request) interface{} {
@@ -82,19 +154,205 @@ func (s *Server) QrCode(r *http.Request) interface{} {
 
 func (s *Server) Winner(r *http.Request) interface{} {
 	dt := s.QueryParam(r, "dt")
-	var (
-		w   *db.WinnerInfo
-		err error
-	)
-	item, ok := util.Cache.Get(dt)
+	var w *db.WinnerInfo
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	cKey := fmt.Sprintf("winner:%d:%s", pot.ID, dt)
+	item, ok := util.Cache.Get(cKey)
 	if !ok {
-		w, err = db.GetWinner(dt)
+		w, err = db.GetWinner(pot.ID, dt)
 		if err != nil {
 			return err
 		}
-		util.Cache.Set(dt, w, time.Hour*24)
+		util.Cache.Set(cKey, w, time.Hour*24)
 	} else {
 		w = item.(*db.WinnerInfo)
 	}
 	return w
 }
+
+func (s *Server) Jobs(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	page, _ := strconv.Atoi(s.QueryParam(r, "p"))
+	jobs, err := db.GetJobs(s.QueryParam(r, "status"), page)
+	if err != nil {
+		return err
+	}
+	return jobs
+}
+
+func (s *Server) RetryJob(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	id, err := strconv.ParseInt(s.QueryParam(r, "id"), 10, 64)
+	if err != nil {
+		return newValidationErr("id", "invalid")
+	}
+	if err := db.RetryJob(id); err != nil {
+		if err == db.ErrJobNotFound {
+			return errNotFound
+		}
+		return err
+	}
+	return "OK"
+}
+
+func (s *Server) PendingPayouts(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	pending, err := db.GetPendingPayouts()
+	if err != nil {
+		return err
+	}
+	return pending
+}
+
+func (s *Server) ApprovePayout(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	if err := db.ApprovePayout(pot.ID, s.QueryParam(r, "month")); err != nil {
+		if err == db.ErrNoPendingPayout {
+			return errNotFound
+		}
+		return err
+	}
+	return "OK"
+}
+
+func (s *Server) DiscardPayout(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	if err := db.DiscardPayout(pot.ID, s.QueryParam(r, "month")); err != nil {
+		if err == db.ErrNoPendingPayout {
+			return errNotFound
+		}
+		if err == db.ErrPayoutPartlyRelayed {
+			return alertError{Title: "Discard payout", Message: err.Error()}
+		}
+		return err
+	}
+	return "OK"
+}
+
+// ResolvePayout closes a payout left for review, ?sent=true when the wallet shows it went out
+// otherwise it's sent again
+func (s *Server) ResolvePayout(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	sent, _ := strconv.ParseBool(s.QueryParam(r, "sent"))
+	if err := db.ResolvePayout(pot.ID, s.QueryParam(r, "month"), sent); err != nil {
+		if err == db.ErrNoPendingPayout {
+			return errNotFound
+		}
+		return err
+	}
+	return "OK"
+}
+
+// UnsignedPayout downloads the unsigned_txset of a view-only payout to sign offline
+func (s *Server) UnsignedPayout(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	txset, err := db.GetUnsignedTxset(pot.ID, s.QueryParam(r, "month"))
+	if err != nil {
+		if err == db.ErrNoPendingPayout {
+			return errNotFound
+		}
+		return err
+	}
+	return rpcType{
+		contentType: "text/plain; charset=UTF-8",
+		body:        []byte(txset),
+	}
+}
+
+func (s *Server) SubmitPayout(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	type request struct {
+		SignedTxset string   `json:"signed_txset" validate:"required"`
+		TxHashList  []string `json:"tx_hash_list" validate:"required"`
+		TxKeyList   []string `json:"tx_key_list" validate:"required"`
+	}
+	var req request
+	if err := s.bind(r, &req); err != nil {
+		return err
+	}
+	pot, err := s.getPot(r)
+	if err != nil {
+		return err
+	}
+	if err := db.SubmitSignedPayout(pot.ID, s.QueryParam(r, "month"), &monerorpc.SignTransferResponse{
+		SignedTxset: req.SignedTxset,
+		TxHashList:  req.TxHashList,
+		TxKeyList:   req.TxKeyList,
+	}); err != nil {
+		if err == db.ErrNoPendingPayout {
+			return errNotFound
+		}
+		if err == db.ErrSignedPayoutMismatch {
+			return alertError{Title: "Submit payout", Message: err.Error()}
+		}
+		return err
+	}
+	return "OK"
+}
+
+func (s *Server) Daemons(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	return db.GetDaemonStatus()
+}
+
+// Prices lists the quotes of every price source, ?date=2021-11-20 for a single day
+func (s *Server) Prices(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	page, _ := strconv.Atoi(s.QueryParam(r, "p"))
+	prices, err := db.GetPrices(s.QueryParam(r, "date"), page)
+	if err != nil {
+		return err
+	}
+	return prices
+}
+
+// EntryPrices lists when the entry price changed, transfers are credited at the price of their time
+func (s *Server) EntryPrices(r *http.Request) interface{} {
+	if !s.isAdmin(r) {
+		return errAuth
+	}
+	prices, err := db.GetEntryPrices()
+	if err != nil {
+		return err
+	}
+	return prices
+}
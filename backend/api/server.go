@@ -7,12 +7,13 @@ import (
 	"io"
 	"io/fs"
 	"io/ioutil"
-	"log"
+	"moneropot/db"
 	"moneropot/util"
 	"net"
 	"net/http"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -42,6 +43,8 @@ type (
 	}
 )
 
+const requestIDHeader = "X-Request-ID"
+
 var (
 	errAuth      = fmt.Errorf("not logged in")
 	errForbidden = fmt.Errorf("forbidden")
@@ -49,6 +52,11 @@ var (
 	errRateLimit = fmt.Errorf("rate limit")
 
 	StaticFS embed.FS
+
+	validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+	httpDuration = util.NewHistogram("moneropot_http_request_duration_seconds", "Api request latency by route.",
+		util.DefaultBuckets, "method", "route")
 )
 
 // Error validation error
@@ -89,11 +97,23 @@ func NewServer() *Server {
 		return validUsername.Match([]byte(fl.Field().String()))
 	})
 	r.Use(srv.limits)
+	r.HandleFunc("/healthz", srv.handleHealth(false)).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", srv.handleHealth(true)).Methods(http.MethodGet)
+	r.HandleFunc("/metrics", handleMetrics).Methods(http.MethodGet)
 	sr := r.PathPrefix("/api").Subrouter()
 
+	// routes without a pot id are served by the default pot
 	sr.HandleFunc("/accounts", srv.handlePostAccount()).Methods(http.MethodPost)
 	sr.HandleFunc("/info", srv.handleGetInfo()).Methods(http.MethodGet)
 	sr.HandleFunc("/entries", srv.handleGetEntries()).Methods(http.MethodGet)
+	sr.HandleFunc("/payouts", srv.handleGetPayouts()).Methods(http.MethodGet)
+	sr.HandleFunc("/payments", srv.handleGetPayments()).Methods(http.MethodGet)
+	sr.HandleFunc("/pots", srv.handleGetPots()).Methods(http.MethodGet)
+	sr.HandleFunc("/pots/{id:[0-9]+}/accounts", srv.handlePostAccount()).Methods(http.MethodPost)
+	sr.HandleFunc("/pots/{id:[0-9]+}/info", srv.handleGetInfo()).Methods(http.MethodGet)
+	sr.HandleFunc("/pots/{id:[0-9]+}/entries", srv.handleGetEntries()).Methods(http.MethodGet)
+	sr.HandleFunc("/pots/{id:[0-9]+}/payouts", srv.handleGetPayouts()).Methods(http.MethodGet)
+	sr.HandleFunc("/pots/{id:[0-9]+}/payments", srv.handleGetPayments()).Methods(http.MethodGet)
 	sr.HandleFunc("/events", util.HandleEvents).Methods(http.MethodGet)
 
 	// internal is subject to changes without notice
@@ -110,7 +130,7 @@ func NewServer() *Server {
 			result := rr[0].Interface()
 			if result != nil {
 				if err, ok := result.(error); ok {
-					srv.writeError(w, err)
+					srv.writeError(w, r, err)
 					return
 				} else if rt, ok := result.(rpcType); ok {
 					w.Header().Set("Content-Type", rt.contentType)
@@ -121,7 +141,7 @@ func NewServer() *Server {
 			srv.writeJSON(w, result)
 			return
 		}
-		srv.writeError(w, errNotFound)
+		srv.writeError(w, r, errNotFound)
 	}).Methods(http.MethodPost, http.MethodGet)
 
 	// catch all
@@ -131,15 +151,35 @@ func NewServer() *Server {
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	st := util.UtcNow()
-	if !util.Config.Production {
-		log.Println(r.Method, r.URL.Path)
+	// every line logged for the request, wallet calls included, carries its id
+	id := r.Header.Get(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = util.RandomString(16)
+	}
+	w.Header().Set(requestIDHeader, id)
+	r = r.WithContext(util.WithLogger(r.Context(), util.Log.With("request_id", id)))
+	s.log(r).Debug("request", "method", r.Method, "path", r.URL.Path)
+	// label by route so paths with ids don't each get their own series
+	route := "unmatched"
+	var match mux.RouteMatch
+	if s.router.Match(r, &match) && match.Route != nil {
+		if tpl, err := match.Route.GetPathTemplate(); err == nil {
+			route = tpl
+		}
 	}
 	s.router.ServeHTTP(w, r)
-	if tt := time.Since(st).Milliseconds(); tt > 1000 {
-		log.Println("Slow request:", r.Method, r.RequestURI, "took", tt, "ms")
+	d := time.Since(st)
+	httpDuration.Observe(d.Seconds(), r.Method, route)
+	if tt := d.Milliseconds(); tt > 1000 {
+		s.log(r).Warn("slow request", "method", r.Method, "uri", r.RequestURI, "took_ms", tt)
 	}
 }
 
+// log is the logger of the request with its request id
+func (s *Server) log(r *http.Request) *util.Logger {
+	return util.LogFrom(r.Context()).With("component", "api")
+}
+
 func (s *Server) isAdmin(r *http.Request) bool {
 	cKey := "isAdmin:" + s.RealIP(r)
 	_, ok := util.Cache.Get(cKey)
@@ -161,7 +201,7 @@ func (s *Server) handler(f func(r *http.Request) interface{}) http.HandlerFunc {
 		result := f(r)
 		if result != nil {
 			if err, ok := result.(error); ok {
-				s.writeError(w, err)
+				s.writeError(w, r, err)
 				return
 			}
 		}
@@ -169,7 +209,7 @@ func (s *Server) handler(f func(r *http.Request) interface{}) http.HandlerFunc {
 	}
 }
 
-func (s *Server) writeError(w http.ResponseWriter, err error) bool {
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) bool {
 	if err == nil {
 		return false
 	}
@@ -194,10 +234,10 @@ func (s *Server) writeError(w http.ResponseWriter, err error) bool {
 		msg = e.Message
 		resp["title"] = e.Title
 	} else if _, ok := err.(*json.UnmarshalTypeError); ok {
-		log.Printf("UnmarshalTypeError: %v", err)
+		s.log(r).Info("json type error", "error", err)
 		code = http.StatusBadRequest
 	} else if _, ok := err.(*json.SyntaxError); ok {
-		log.Printf("JsonSyntaxError: %v", err)
+		s.log(r).Info("json syntax error", "error", err)
 		code = http.StatusBadRequest
 	} else if err == errNotFound {
 		code = http.StatusNotFound
@@ -208,7 +248,7 @@ func (s *Server) writeError(w http.ResponseWriter, err error) bool {
 	} else if err == errRateLimit {
 		code = http.StatusServiceUnavailable
 	} else {
-		log.Printf("InternalError: %v", err)
+		s.log(r).Error("internal error", "method", r.Method, "path", r.URL.Path, "error", err)
 	}
 
 	if msg == "" && code > 0 {
@@ -224,12 +264,16 @@ func (s *Server) writeError(w http.ResponseWriter, err error) bool {
 }
 
 func (s *Server) writeJSON(w http.ResponseWriter, resp interface{}) {
+	s.writeJSONStatus(w, http.StatusOK, resp)
+}
+
+func (s *Server) writeJSONStatus(w http.ResponseWriter, status int, resp interface{}) {
 	if resp == nil {
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		panic(err)
 	}
@@ -293,6 +337,32 @@ func (s *Server) QueryParam(r *http.Request, name string) string {
 	return ""
 }
 
+// getPot returns the pot from the route id or the pot query parameter, defaults to the first pot
+func (s *Server) getPot(r *http.Request) (*db.Pot, error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		id = s.QueryParam(r, "pot")
+	}
+	potID := int64(db.DefaultPotID)
+	if id != "" {
+		var err error
+		if potID, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return nil, errNotFound
+		}
+	}
+	pot, err := db.GetPot(potID)
+	if err != nil {
+		if err == db.ErrPotNotFound {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	if !pot.Active {
+		return nil, errNotFound
+	}
+	return pot, nil
+}
+
 func newValidationErr(params ...string) validationError {
 	p := make(map[string]string)
 	for i := 0; i < len(params); i += 2 {
@@ -306,7 +376,7 @@ func newValidationErr(params ...string) validationError {
 func (s *Server) handleCatchAll() http.HandlerFunc {
 	contentStatic, err := fs.Sub(StaticFS, "dist")
 	if err != nil {
-		log.Fatalf("handleCatchAll error %v", err)
+		util.Log.Fatal("static files failed", "component", "api", "error", err)
 	}
 	handler := http.FileServer(http.FS(contentStatic))
 
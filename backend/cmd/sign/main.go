@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"moneropot/monerorpc"
+
+	"github.com/gabstv/httpdigest"
+	"github.com/namsral/flag"
+)
+
+// sign signs a view-only payout with an offline wallet-rpc holding the spend key,
+// the output is uploaded as is to /api/internal/SubmitPayout
+//
+//	curl -s -H "X-Key: $ADMIN_KEY" https://moneropot.org/api/internal/UnsignedPayout?month=2021-10 > unsigned.txt
+//	sign -in unsigned.txt -out signed.json
+//	curl -s -H "X-Key: $ADMIN_KEY" -d @signed.json https://moneropot.org/api/internal/SubmitPayout?month=2021-10
+func main() {
+	var (
+		rpcAddress, rpcUser, rpcPass, in, out string
+	)
+	flag.StringVar(&rpcAddress, "rpc-address", "http://127.0.0.1:18083/json_rpc", "offline wallet rpc address")
+	flag.StringVar(&rpcUser, "rpc-user", "", "offline wallet rpc user")
+	flag.StringVar(&rpcPass, "rpc-pass", "", "offline wallet rpc password")
+	flag.StringVar(&in, "in", "-", "unsigned_txset file, - for stdin")
+	flag.StringVar(&out, "out", "-", "signed json file, - for stdout")
+	flag.Parse()
+
+	var (
+		b   []byte
+		err error
+	)
+	if in == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(in)
+	}
+	if err != nil {
+		log.Fatalf("sign read error %v", err)
+	}
+	wallet := monerorpc.New(monerorpc.Config{
+		Address:   rpcAddress,
+		Transport: httpdigest.New(rpcUser, rpcPass),
+	})
+	resp, err := wallet.SignTransfer(&monerorpc.SignTransferRequest{
+		UnsignedTxset: strings.TrimSpace(string(b)),
+		GetTxKeys:     true,
+	})
+	if err != nil {
+		log.Fatalf("sign error %v", err)
+	}
+	signed, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		log.Fatalf("sign marshal error %v", err)
+	}
+	if out == "-" {
+		os.Stdout.Write(append(signed, '\n'))
+		return
+	}
+	if err := ioutil.WriteFile(out, signed, 0600); err != nil {
+		log.Fatalf("sign write error %v", err)
+	}
+	log.Println("signed", len(resp.TxHashList), "transactions to", out)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+
+	"moneropot/db"
+	"moneropot/util"
+
+	"github.com/namsral/flag"
+)
+
+// verify recomputes a past draw offline from the published winner info
+//
+//	verify -json winner.json
+//	curl -s https://moneropot.org/api/internal/Winner?dt=2021-10 | verify -json -
+//	verify -month 2021-10 -sign-key <key> -block <hash> -entries 14
+func main() {
+	var (
+		month, signKey, block, jsonPath, algorithm string
+		entries, tiers                             int
+	)
+	flag.StringVar(&month, "month", "", "draw month (2006-01), informational only")
+	flag.StringVar(&signKey, "sign-key", "", "sign_key used for the draw")
+	flag.StringVar(&block, "block", "", "first block hash of the draw")
+	flag.IntVar(&entries, "entries", 0, "total entries of the draw")
+	flag.IntVar(&tiers, "tiers", 1, "number of prize tiers to print")
+	flag.StringVar(&algorithm, "algorithm", "", "draw algorithm (align, char, mod), defaults to align")
+	flag.StringVar(&jsonPath, "json", "", "winner info json file from /api/internal/Winner, - for stdin")
+	flag.Parse()
+
+	info := &db.WinnerInfo{}
+	if jsonPath != "" {
+		var (
+			b   []byte
+			err error
+		)
+		if jsonPath == "-" {
+			b, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			b, err = ioutil.ReadFile(jsonPath)
+		}
+		if err != nil {
+			log.Fatalf("verify read json error %v", err)
+		}
+		if err := json.Unmarshal(b, info); err != nil {
+			log.Fatalf("verify unmarshal json error %v", err)
+		}
+	}
+	// flags override whatever was loaded from json
+	if month != "" {
+		info.Date = month
+	}
+	if signKey != "" {
+		info.SignKey = signKey
+	}
+	if block != "" {
+		info.Block = block
+	}
+	if entries > 0 {
+		info.Entries = int64(entries)
+	}
+	if algorithm != "" {
+		info.Algorithm = algorithm
+	}
+	if info.SignKey == "" || info.Block == "" || info.Entries == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	selector, err := db.GetWinnerSelector(info.Algorithm)
+	if err != nil {
+		log.Fatalf("verify %v", err)
+	}
+	fmt.Printf("Month:    %s\n", info.Date)
+	fmt.Printf("Sign key: %s\n", info.SignKey)
+	if info.Commitment != "" {
+		if util.Commitment(info.SignKey) != info.Commitment {
+			fmt.Printf("MISMATCH: sign key does not match commitment %s\n", info.Commitment)
+			os.Exit(1)
+		}
+		fmt.Printf("Commit:   %s (matches sign key)\n", info.Commitment)
+	}
+	fmt.Printf("Block:    %s\n", info.Block)
+	fmt.Printf("Entries:  %d\n", info.Entries)
+	if info.Algorithm == "" {
+		info.Algorithm = db.DefaultAlgorithm
+	}
+	fmt.Printf("Algo:     %s\n", info.Algorithm)
+	// published tiers, draws before tiers only have the single winner accounts
+	var published [][]int
+	for _, tier := range info.Tiers {
+		published = append(published, tierEntries(tier.Accounts))
+	}
+	if len(published) == 0 && info.Accounts != nil {
+		published = append(published, tierEntries(info.Accounts))
+	}
+	if tiers < len(published) {
+		tiers = len(published)
+	}
+	drawTiers := db.DrawTiers(selector, info.Block, info.SignKey, int(info.Entries), tiers)
+	mismatch := false
+	for i, tier := range drawTiers {
+		fmt.Printf("Tier %d:   %d winners with score %d\n", i+1, len(tier.Entries), tier.Score)
+		for _, id := range tier.Entries {
+			fmt.Printf("  entry %d hash %s score %d\n", id, util.SignEntry(int64(id), info.SignKey), tier.Score)
+		}
+		if i < len(published) && !sameEntries(tier.Entries, published[i]) {
+			fmt.Printf("MISMATCH: published tier %d winners %v\n", i+1, published[i])
+			mismatch = true
+		}
+	}
+	if mismatch {
+		os.Exit(1)
+	}
+	if len(published) > 0 {
+		fmt.Println("OK: published winners match")
+	}
+}
+
+func tierEntries(accounts map[string][]int) []int {
+	var entries []int
+	for _, ids := range accounts {
+		entries = append(entries, ids...)
+	}
+	sort.Ints(entries)
+	return entries
+}
+
+func sameEntries(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,11 +1,10 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"moneropot/util"
-	"strconv"
 
 	"moneropot/monerorpc"
 )
@@ -17,6 +16,7 @@ var (
 type (
 	Account struct {
 		ID           int64   `db:"id"`
+		PotID        int64   `db:"pot_id"`
 		AddressIndex uint64  `db:"address_index"`
 		Address      string  `db:"address"`
 		UserName     *string `db:"user_name"`
@@ -28,32 +28,38 @@ type (
 	}
 
 	Winner struct {
-		Date         string  `db:"date"`
-		Info         string  `db:"info"`
-		TransferBody *string `db:"transfer_body"`
+		PotID         int64   `db:"pot_id"`
+		Date          string  `db:"date"`
+		Info          string  `db:"info"`
+		TransferBody  *string `db:"transfer_body"`
+		PayoutStatus  string  `db:"payout_status"`
+		PayoutPreview *string `db:"payout_preview"`
+		// PayoutRelayed are the hashes of the previewed txs already relayed, comma separated
+		PayoutRelayed string `db:"payout_relayed"`
 	}
 
 	Amount struct {
-		Winner      uint64 `json:"winner"`
-		Fund        uint64 `json:"fund"`
-		Referrals   uint64 `json:"referrals"`
-		Maintenance uint64 `json:"maintenance"`
+		Winner      uint64   `json:"winner"`
+		Fund        uint64   `json:"fund"`
+		Referrals   uint64   `json:"referrals"`
+		Maintenance uint64   `json:"maintenance"`
+		Tiers       []uint64 `json:"tiers"`
 	}
 
 	Entry struct {
 		ID        int64  `json:"id" db:"id"`
+		PotID     int64  `json:"-" db:"pot_id"`
 		AccountID int64  `json:"-" db:"account_id"`
 		Hash      string `json:"hash" db:"hash"`
+		TxID      string `json:"-" db:"tx_id"`
 	}
 )
 
-func (a *Account) AddressUri(amount uint64) (string, error) {
-	walletLock.Lock()
-	r, err := Wallet.MakeUri(&monerorpc.MakeUriRequest{
+func (a *Account) AddressUri(ctx context.Context, amount uint64) (string, error) {
+	r, err := walletFor(ctx).MakeUri(&monerorpc.MakeUriRequest{
 		Address: a.Address,
 		Amount:  amount,
 	})
-	walletLock.Unlock()
 	if err != nil {
 		return "", fmt.Errorf("AddressUri error %v", err)
 	}
@@ -74,6 +80,7 @@ func (a *Account) Save() error {
 	db := MustDB()
 	if a.ID == 0 {
 		r, err := db.NamedExec(`INSERT INTO accounts (
+			pot_id,
 			address_index,
 			address,
 			user_name,
@@ -84,6 +91,7 @@ func (a *Account) Save() error {
 			ref_id
 			)
 			VALUES (
+			:pot_id,
 			:address_index,
 			:address,
 			:user_name,
@@ -112,16 +120,16 @@ func (a *Account) Save() error {
 	return err
 }
 
-func GetAccount(userAddress string, userName *string, referrer *string) (*Account, error) {
+func GetAccount(ctx context.Context, pot *Pot, userAddress string, userName *string, referrer *string) (*Account, error) {
 	db := MustDB()
 	account := &Account{}
 	// first find your active account then inactive account
-	err := db.Get(account, `SELECT * FROM accounts WHERE active = true AND user_address = $1`, userAddress)
+	err := db.Get(account, `SELECT * FROM accounts WHERE pot_id = $1 AND active = true AND user_address = $2`, pot.ID, userAddress)
 	if err != nil {
 		if !util.NoRows(err) {
 			return nil, fmt.Errorf("GetAccount: select error %v", err)
 		}
-		err = db.Get(account, `SELECT * FROM accounts WHERE active = false ORDER BY address_index`)
+		err = db.Get(account, `SELECT * FROM accounts WHERE pot_id = $1 AND active = false ORDER BY address_index`, pot.ID)
 		if err != nil {
 			if !util.NoRows(err) {
 				return nil, fmt.Errorf("GetAccount: select error %v", err)
@@ -131,7 +139,7 @@ func GetAccount(userAddress string, userName *string, referrer *string) (*Accoun
 
 	if userName != nil && account.UserName == nil {
 		acct := &Account{}
-		err = db.Get(acct, `SELECT * FROM accounts WHERE user_name = $1`, *userName)
+		err = db.Get(acct, `SELECT * FROM accounts WHERE pot_id = $1 AND user_name = $2`, pot.ID, *userName)
 		if !util.NoRows(err) {
 			return nil, ErrDuplicateUser
 		}
@@ -139,7 +147,7 @@ func GetAccount(userAddress string, userName *string, referrer *string) (*Accoun
 	updateAccount := false
 	if referrer != nil && account.RefID == 0 {
 		refAcct := &Account{}
-		err = db.Get(refAcct, `SELECT * FROM accounts WHERE user_name = $1`, *referrer)
+		err = db.Get(refAcct, `SELECT * FROM accounts WHERE pot_id = $1 AND user_name = $2`, pot.ID, *referrer)
 		if !util.NoRows(err) && refAcct.ID != account.ID {
 			account.RefID = refAcct.ID
 			updateAccount = true
@@ -159,12 +167,11 @@ func GetAccount(userAddress string, userName *string, referrer *string) (*Accoun
 		return account, nil
 	}
 	if account.ID == 0 {
-		walletLock.Lock()
-		resp, err := Wallet.CreateAddress(&monerorpc.CreateAddressRequest{})
-		walletLock.Unlock()
+		resp, err := walletFor(ctx).CreateAddress(&monerorpc.CreateAddressRequest{AccountIndex: pot.AccountIndex})
 		if err != nil {
 			return nil, fmt.Errorf("GetAccount: error wallet.create_address %v", err)
 		}
+		account.PotID = pot.ID
 		account.AddressIndex = resp.AddressIndex
 		account.Address = resp.Address
 	}
@@ -175,14 +182,16 @@ func GetAccount(userAddress string, userName *string, referrer *string) (*Accoun
 	if err := account.Save(); err != nil {
 		return nil, err
 	}
+	util.LogFrom(ctx).Info("account assigned", "component", "accounts", "pot_id", pot.ID, "account_id", account.ID,
+		"address_index", account.AddressIndex)
 	return account, nil
 }
 
-func GetIdByUsername(userName string) (int64, error) {
+func GetIdByUsername(potID int64, userName string) (int64, error) {
 	db := MustDB()
 	account := &Account{}
 	err := db.Get(account, `SELECT * FROM accounts
-	WHERE active = 1 AND user_name = $1`, userName)
+	WHERE pot_id = $1 AND active = 1 AND user_name = $2`, potID, userName)
 	if err != nil {
 		if !util.NoRows(err) {
 			return 0, fmt.Errorf("CreateAccount: select error %v", err)
@@ -192,14 +201,14 @@ func GetIdByUsername(userName string) (int64, error) {
 	return account.ID, nil
 }
 
-func GetWinner(dt string) (*WinnerInfo, error) {
+func GetWinner(potID int64, dt string) (*WinnerInfo, error) {
 	db := MustDB()
 	winner := Winner{}
 	var err error
 	if dt == "" {
-		err = db.Get(&winner, `SELECT * FROM winners ORDER BY date DESC`)
+		err = db.Get(&winner, `SELECT * FROM winners WHERE pot_id = ? ORDER BY date DESC`, potID)
 	} else {
-		err = db.Get(&winner, `SELECT * FROM winners WHERE date = ?`, dt)
+		err = db.Get(&winner, `SELECT * FROM winners WHERE pot_id = ? AND date = ?`, potID, dt)
 	}
 	if err != nil {
 		if util.NoRows(err) {
@@ -211,59 +220,68 @@ func GetWinner(dt string) (*WinnerInfo, error) {
 	if err := json.Unmarshal([]byte(winner.Info), winInfo); err != nil {
 		return nil, fmt.Errorf("GetWinner error %v", err)
 	}
-	accounts := winInfo.Accounts
-	winInfo.Accounts = make(map[string][]int)
-	for k, v := range accounts {
-		winInfo.Accounts[k[0:5]+"..."+k[len(k)-5:]] = v
+	winInfo.Accounts = maskAccounts(winInfo.Accounts)
+	for i := range winInfo.Tiers {
+		winInfo.Tiers[i].Accounts = maskAccounts(winInfo.Tiers[i].Accounts)
 	}
 	return winInfo, nil
 }
 
-func TotalEntries() (int64, error) {
-	total, err := GetMetadata("entry_id", "0")
+func maskAccounts(accounts map[string][]int) map[string][]int {
+	masked := make(map[string][]int)
+	for k, v := range accounts {
+		masked[k[0:5]+"..."+k[len(k)-5:]] = v
+	}
+	return masked
+}
+
+func TotalEntries(potID int64) (int64, error) {
+	pot, err := GetPot(potID)
 	if err != nil {
 		return 0, err
 	}
-	t, _ := strconv.ParseInt(total, 10, 64)
-	return t, nil
+	return pot.EntryID, nil
 }
 
-func GetDistributedAmounts(all bool) (*Amount, error) {
-	walletLock.Lock()
-	balance, err := Wallet.GetBalance(&monerorpc.GetBalanceRequest{})
-	walletLock.Unlock()
+func GetDistributedAmounts(ctx context.Context, pot *Pot, all bool) (*Amount, error) {
+	balance, err := walletFor(ctx).GetBalance(&monerorpc.GetBalanceRequest{AccountIndex: pot.AccountIndex})
 	if err != nil {
 		return nil, fmt.Errorf("GetDistributedAmounts error %v", err)
 	}
 	if all && balance.UnlockedBalance != balance.Balance {
 		return nil, fmt.Errorf("GetDistributedAmounts has locked balance")
 	}
-	// keep 1XMR reserve for transfer fees
+	// keep a reserve for transfer fees
+	split := util.Config.Split
 	var bal float64
-	if 1e12 > balance.Balance {
+	if split.FeeReserve > balance.Balance {
 		bal = 0
 	} else {
-		bal = float64(balance.Balance - 1e12)
+		bal = float64(balance.Balance - split.FeeReserve)
 	}
 	amt := &Amount{
-		Winner:      uint64(bal * .7),
-		Fund:        uint64(bal * .05),
-		Referrals:   uint64(bal * .15),
-		Maintenance: uint64(bal * .1),
+		Winner:      util.Percent(bal, split.Winner),
+		Fund:        util.Percent(bal, split.Fund),
+		Referrals:   util.Percent(bal, split.Referrals),
+		Maintenance: util.Percent(bal, split.Maintenance),
+	}
+	for _, tier := range split.Tiers {
+		amt.Tiers = append(amt.Tiers, util.Percent(bal, tier))
 	}
 	return amt, nil
 }
 
-func GetEntries(accountID int64, page int) ([]Entry, error) {
+func GetEntries(potID int64, accountID int64, page int) ([]Entry, error) {
 	db := MustDB()
 	var (
 		entries []Entry
 		args    []interface{}
 	)
-	sql := `SELECT * FROM entries`
+	sql := `SELECT * FROM entries WHERE pot_id = ?`
+	args = append(args, potID)
 	limit := 100
 	if accountID > 0 {
-		sql += ` WHERE account_id = ?`
+		sql += ` AND account_id = ?`
 		args = append(args, accountID)
 	}
 
@@ -277,20 +295,32 @@ func GetEntries(accountID int64, page int) ([]Entry, error) {
 
 // check current wallet if matches db
 func syncWallet() error {
+	pots, err := GetPots()
+	if err != nil {
+		return fmt.Errorf("syncWallet pots error %v", err)
+	}
+	for i := range pots {
+		if err := syncPotWallet(&pots[i]); err != nil {
+			return err
+		}
+	}
+	updatePotMetrics()
+	return nil
+}
+
+func syncPotWallet(pot *Pot) error {
 	db := MustDB()
 	var (
 		accounts []Account
 	)
-	sql := `SELECT * FROM accounts ORDER BY address_index`
-	if err := db.Select(&accounts, sql); err != nil {
+	sql := `SELECT * FROM accounts WHERE pot_id = $1 ORDER BY address_index`
+	if err := db.Select(&accounts, sql, pot.ID); err != nil {
 		return fmt.Errorf("syncWallet select error %v", err)
 	}
 
 	addressMap := map[uint64]string{}
 	acctMap := make(map[uint64]*Account)
-	walletLock.Lock()
-	r, err := Wallet.GetAddress(&monerorpc.GetAddressRequest{})
-	walletLock.Unlock()
+	r, err := Wallet.GetAddress(&monerorpc.GetAddressRequest{AccountIndex: pot.AccountIndex})
 	if err != nil {
 		return fmt.Errorf("syncWallet GetAddress error %v", err)
 	}
@@ -305,7 +335,7 @@ func syncWallet() error {
 	}
 	wt := len(addressMap)
 	at := len(accounts)
-	log.Println("Wallet Total: ", wt, " Accounts Total: ", at)
+	walletLog.Info("sync wallet", "pot_id", pot.ID, "addresses", wt, "accounts", at)
 	h := wt
 	if at > h {
 		h = at
@@ -316,21 +346,19 @@ func syncWallet() error {
 		acct, okAcct := acctMap[k]
 		addr, okAddr := addressMap[k]
 		if !okAcct && okAddr {
-			sql += fmt.Sprintf(`INSERT INTO accounts (address_index, address, active) VALUES (%d, '%s', 0);`, k, addr)
+			sql += fmt.Sprintf(`INSERT INTO accounts (pot_id, address_index, address, active) VALUES (%d, %d, '%s', 0);`, pot.ID, k, addr)
 		} else if !okAddr && okAcct {
-			walletLock.Lock()
-			r, err := Wallet.CreateAddress(&monerorpc.CreateAddressRequest{})
-			walletLock.Unlock()
+			r, err := Wallet.CreateAddress(&monerorpc.CreateAddressRequest{AccountIndex: pot.AccountIndex})
 			if err != nil {
 				return fmt.Errorf("syncWallet GetAddress error %v", err)
 			}
-			sql += fmt.Sprintf(`UPDATE accounts SET address = '%s' WHERE address_index = %d;`, r.Address, r.AddressIndex)
+			sql += fmt.Sprintf(`UPDATE accounts SET address = '%s' WHERE pot_id = %d AND address_index = %d;`, r.Address, pot.ID, r.AddressIndex)
 		} else if acct.Address != addr {
-			sql += fmt.Sprintf(`UPDATE accounts SET address = '%s' WHERE address_index = %d;`, addr, k)
+			sql += fmt.Sprintf(`UPDATE accounts SET address = '%s' WHERE pot_id = %d AND address_index = %d;`, addr, pot.ID, k)
 		}
 	}
 	if len(sql) > 0 {
-		log.Println("syncing wallet...")
+		walletLog.Info("syncing wallet addresses", "pot_id", pot.ID)
 		if _, err := db.Exec(sql); err != nil {
 			return fmt.Errorf("syncWallet db.Exec error %v", err)
 		}
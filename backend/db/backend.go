@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"moneropot/monerorpc"
+	"moneropot/util"
+)
+
+type (
+	// WalletBackend is everything the pots need from the wallet, *monerorpc.Client is the
+	// real one and a simulator, a failover pair or a recording proxy can stand in for it
+	WalletBackend interface {
+		CreateAccount(req *monerorpc.CreateAccountRequest) (*monerorpc.CreateAccountResponse, error)
+		CreateAddress(req *monerorpc.CreateAddressRequest) (*monerorpc.CreateAddressResponse, error)
+		GetAddress(req *monerorpc.GetAddressRequest) (*monerorpc.GetAddressResponse, error)
+		ValidateAddress(req *monerorpc.ValidateAddressRequest) (*monerorpc.ValidateAddressResponse, error)
+		MakeUri(req *monerorpc.MakeUriRequest) (*monerorpc.MakeUriResponse, error)
+		GetBalance(req *monerorpc.GetBalanceRequest) (*monerorpc.GetBalanceResponse, error)
+		GetTransfers(req *monerorpc.GetTransfersRequest) (*monerorpc.GetTransfersResponse, error)
+		Transfer(req *monerorpc.TransferRequest) (*monerorpc.TransferResponse, error)
+		TransferSplit(req *monerorpc.TransferSplitRequest) (*monerorpc.TransferSplitResponse, error)
+		RelayTx(req *monerorpc.RelayTxRequest) (*monerorpc.RelayTxResponse, error)
+		SubmitTransfer(req *monerorpc.SubmitTransferRequest) (*monerorpc.SubmitTransferResponse, error)
+		CheckTxKey(req *monerorpc.CheckTxKeyRequest) (*monerorpc.CheckTxKeyResponse, error)
+		GetHeight() (*monerorpc.GetHeightResponse, error)
+	}
+
+	// ChainBackend is what the draws need from the daemon
+	ChainBackend interface {
+		GetLastBlockHeader() (*monerorpc.GetLastBlockHeaderResponse, error)
+		GetBlockHeadersRange(req *monerorpc.GetBlockHeadersRangeRequest) (*monerorpc.GetLastBlockHeadersRangeResponse, error)
+	}
+
+	// lockedWallet makes one wallet call at a time, the wallet rpc works on a single open wallet
+	lockedWallet struct {
+		sem    chan struct{}
+		ctx    context.Context
+		wallet WalletBackend
+		log    *util.Logger
+	}
+
+	lockedChain struct {
+		mu    sync.Mutex
+		chain ChainBackend
+	}
+)
+
+var (
+	Wallet WalletBackend
+	Daemon ChainBackend
+
+	_ WalletBackend = (*monerorpc.Client)(nil)
+	_ ChainBackend  = (*monerorpc.Client)(nil)
+)
+
+// SetBackends replaces the wallet and daemons, calls to each are serialized and the
+// daemons fail over in order
+func SetBackends(wallet WalletBackend, chains ...ChainEndpoint) {
+	Wallet = &lockedWallet{sem: make(chan struct{}, 1), ctx: context.Background(), wallet: wallet, log: walletLog}
+	daemons = newFailoverChain(chains)
+	Daemon = daemons
+}
+
+// walletFor is the wallet for the calls of an api request, they log with the fields of the
+// logger in ctx so they carry its request id and give up once the request is cancelled
+func walletFor(ctx context.Context) WalletBackend {
+	w, ok := Wallet.(*lockedWallet)
+	if !ok {
+		return Wallet
+	}
+	traced := *w
+	traced.ctx = ctx
+	traced.log = util.LogFrom(ctx).With("component", "wallet")
+	if c, ok := w.wallet.(*monerorpc.Client); ok {
+		traced.wallet = c.WithContext(ctx)
+	}
+	return &traced
+}
+
+// call takes the wallet until the returned func is called and logs how long the call took,
+// waiting for the wallet stops when the ctx of the calls is done
+func (w *lockedWallet) call(method string) (func(), error) {
+	select {
+	case w.sem <- struct{}{}:
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	}
+	st := time.Now()
+	return func() {
+		<-w.sem
+		w.log.Debug("wallet call", "method", method, "took", time.Since(st))
+	}, nil
+}
+
+func (w *lockedWallet) CreateAccount(req *monerorpc.CreateAccountRequest) (*monerorpc.CreateAccountResponse, error) {
+	done, err := w.call("create_account")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.CreateAccount(req)
+}
+
+func (w *lockedWallet) CreateAddress(req *monerorpc.CreateAddressRequest) (*monerorpc.CreateAddressResponse, error) {
+	done, err := w.call("create_address")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.CreateAddress(req)
+}
+
+func (w *lockedWallet) GetAddress(req *monerorpc.GetAddressRequest) (*monerorpc.GetAddressResponse, error) {
+	done, err := w.call("get_address")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.GetAddress(req)
+}
+
+func (w *lockedWallet) ValidateAddress(req *monerorpc.ValidateAddressRequest) (*monerorpc.ValidateAddressResponse, error) {
+	done, err := w.call("validate_address")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.ValidateAddress(req)
+}
+
+func (w *lockedWallet) MakeUri(req *monerorpc.MakeUriRequest) (*monerorpc.MakeUriResponse, error) {
+	done, err := w.call("make_uri")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.MakeUri(req)
+}
+
+func (w *lockedWallet) GetBalance(req *monerorpc.GetBalanceRequest) (*monerorpc.GetBalanceResponse, error) {
+	done, err := w.call("get_balance")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.GetBalance(req)
+}
+
+func (w *lockedWallet) GetTransfers(req *monerorpc.GetTransfersRequest) (*monerorpc.GetTransfersResponse, error) {
+	done, err := w.call("get_transfers")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.GetTransfers(req)
+}
+
+func (w *lockedWallet) Transfer(req *monerorpc.TransferRequest) (*monerorpc.TransferResponse, error) {
+	done, err := w.call("transfer")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.Transfer(req)
+}
+
+func (w *lockedWallet) TransferSplit(req *monerorpc.TransferSplitRequest) (*monerorpc.TransferSplitResponse, error) {
+	done, err := w.call("transfer_split")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.TransferSplit(req)
+}
+
+func (w *lockedWallet) RelayTx(req *monerorpc.RelayTxRequest) (*monerorpc.RelayTxResponse, error) {
+	done, err := w.call("relay_tx")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.RelayTx(req)
+}
+
+func (w *lockedWallet) SubmitTransfer(req *monerorpc.SubmitTransferRequest) (*monerorpc.SubmitTransferResponse, error) {
+	done, err := w.call("submit_transfer")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.SubmitTransfer(req)
+}
+
+func (w *lockedWallet) CheckTxKey(req *monerorpc.CheckTxKeyRequest) (*monerorpc.CheckTxKeyResponse, error) {
+	done, err := w.call("check_tx_key")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.CheckTxKey(req)
+}
+
+func (w *lockedWallet) GetHeight() (*monerorpc.GetHeightResponse, error) {
+	done, err := w.call("get_height")
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return w.wallet.GetHeight()
+}
+
+func (c *lockedChain) GetLastBlockHeader() (*monerorpc.GetLastBlockHeaderResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chain.GetLastBlockHeader()
+}
+
+func (c *lockedChain) GetBlockHeadersRange(req *monerorpc.GetBlockHeadersRangeRequest) (*monerorpc.GetLastBlockHeadersRangeResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chain.GetBlockHeadersRange(req)
+}
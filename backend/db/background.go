@@ -4,7 +4,6 @@ import (
 	"database/sql"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"moneropot/util"
 	"os"
 	"path/filepath"
@@ -15,59 +14,61 @@ import (
 	"moneropot/monerorpc"
 )
 
-var (
-	pickWinnerTimer  *time.Timer
-	checkTransferCtr int64
-)
+// payment is an amount to buy entries with at price, without a price it adds to the next payment,
+// the entries bought are linked to the transaction txid
+type payment struct {
+	amount uint64
+	price  uint64
+	txid   string
+}
 
+// checkTransfers scans incoming transfers into entries, runs and errors are counted in /metrics
+// and the pot gauges are updated after it
 func checkTransfers() {
-	checkMins := int64(120)
-	if !util.Config.Production {
-		log.Println("checkTransfers...", checkTransferCtr)
-		checkMins = 2
-	}
-	if checkTransferCtr%checkMins == 0 {
-		// check missed transfers every hour
-		if !util.Config.Production {
-			log.Println("checking missed transfers...")
-		}
-		if err := CheckMissedTransfers(); err != nil {
-			log.Println("checkTransfers missed transfer error: ", err)
-			return
-		}
+	transferLog.Debug("checking transfers")
+	checkTransfersRuns.Inc()
+	if err := scanTransfers(); err != nil {
+		checkTransfersErrors.Inc()
+		transferLog.Error("check transfers failed", "error", err)
 	}
-	checkTransferCtr++
+	updatePotMetrics()
+}
 
+func scanTransfers() error {
 	h, err := LastHeight()
 	if err != nil {
-		log.Println("checkTransfers last height error: ", err)
-		return
+		return fmt.Errorf("checkTransfers last height error %v", err)
 	}
 	db, err := GetDB()
 	if err != nil {
-		log.Println("checkTransfers get db error: ", err)
-		return
+		return fmt.Errorf("checkTransfers get db error %v", err)
 	}
-	walletLock.Lock()
 	resp, err := Wallet.GetTransfers(&monerorpc.GetTransfersRequest{
 		In:             true,
 		FilterByHeight: true,
 		MinHeight:      h,
+		AllAccounts:    true,
 	})
-	walletLock.Unlock()
 	if err != nil {
-		log.Println("checkTransfers: ", err)
-		return
+		return fmt.Errorf("checkTransfers error %v", err)
 	}
 	if resp.In == nil {
-		return
+		transfersChecked()
+		return nil
 	}
 	if CurrentPrice == 0 {
 		if err := SetCurrentPrice(); err != nil {
-			log.Println("checkTransfers: failed to set current price", err)
-			return
+			return fmt.Errorf("checkTransfers failed to set current price %v", err)
 		}
 	}
+	potIndexes, err := potAccountIndexes()
+	if err != nil {
+		return fmt.Errorf("checkTransfers pots error %v", err)
+	}
+	history, err := GetEntryPrices()
+	if err != nil {
+		return fmt.Errorf("checkTransfers entry prices error %v", err)
+	}
 	// Create a map of rows to inbound transfers
 	var indexes []string
 	for _, val := range resp.In {
@@ -78,88 +79,134 @@ func checkTransfers() {
 	err = db.Select(&accounts, fmt.Sprintf(`
 		SELECT * FROM accounts WHERE address_index IN (%s) AND active = 1`, strings.Join(indexes, ",")))
 	if err != nil {
-		log.Println("checkTransfers select accounts error: ", err)
-		return
-	}
-	log.Println("checkTransfers found ", len(accounts), " accounts")
-	// Map subaddress_index to callbackDest{url, description}.
-	m := make(map[uint64]*Account)
-	for _, account := range accounts {
-		m[account.AddressIndex] = &account
+		return fmt.Errorf("checkTransfers select accounts error %v", err)
+	}
+	transferLog.Info("found transfers", "transfers", len(resp.In), "accounts", len(accounts), "height", h)
+	// Map wallet account and subaddress index to the pot account
+	m := make(map[monerorpc.SubaddressIndex]*Account)
+	for i := range accounts {
+		account := &accounts[i]
+		potIndex, ok := potIndexes[account.PotID]
+		if !ok {
+			continue
+		}
+		m[monerorpc.SubaddressIndex{Major: potIndex, Minor: account.AddressIndex}] = account
 	}
-	newAmounts := make(map[int64]uint64)
+	potAmounts := make(map[int64]map[int64][]payment)
 	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("checkTransfers begin tx error %v", err)
+	}
 	for _, t := range resp.In {
 		if t.Height > h {
 			h = t.Height
 		}
 
-		account, ok := m[t.SubaddrIndex.Minor]
+		account, ok := m[t.SubaddrIndex]
 		if !ok {
-			log.Printf("No account associated with transfer: %d -> %d", t.SubaddrIndex.Minor, t.Amount)
+			transferLog.Warn("no account for transfer", "txid", t.Txid, "height", t.Height,
+				"major", t.SubaddrIndex.Major, "minor", t.SubaddrIndex.Minor, "amount", t.Amount)
+			// kept so the payment can be looked up, it buys no entries
+			if err := recordTransaction(tx, t, nil, TransactionScan); err != nil {
+				return fmt.Errorf("checkTransfers %v rollback: %v", err, tx.Rollback())
+			}
 			continue
 		}
+		transferLog.Debug("transfer", "pot_id", account.PotID, "account_id", account.ID, "txid", t.Txid,
+			"height", t.Height, "amount", t.Amount)
 
+		newAmounts, ok := potAmounts[account.PotID]
+		if !ok {
+			newAmounts = make(map[int64][]payment)
+			potAmounts[account.PotID] = newAmounts
+		}
 		if _, ok := newAmounts[account.ID]; !ok {
-			newAmounts[account.ID] = account.Amount
+			newAmounts[account.ID] = []payment{{amount: account.Amount}}
 		}
-		newAmounts[account.ID] += t.Amount
-		if _, err := tx.Exec(`INSERT INTO transactions (id) VALUES ($1)`, t.Txid); err != nil {
-			log.Println("checkTransfers insert tx error", err, "Rollback:", tx.Rollback())
-			return
+		// the price when the transfer was sent, not the one now
+		newAmounts[account.ID] = append(newAmounts[account.ID], payment{amount: t.Amount, price: priceAt(history, t.Timestamp), txid: t.Txid})
+		if err := recordTransaction(tx, t, account, TransactionScan); err != nil {
+			return fmt.Errorf("checkTransfers %v rollback: %v", err, tx.Rollback())
 		}
 	}
-	if err != nil {
-		log.Println("checkTransfers begin tx error", err)
-		return
-	}
-	if err := createNewEntries(tx, newAmounts, h); err != nil {
-		log.Println("checkTransfers create new entries error", err, "Rollback:", tx.Rollback())
-		return
+	if err := commitNewEntries(tx, potAmounts, h); err != nil {
+		return fmt.Errorf("checkTransfers create new entries error %v rollback: %v", err, tx.Rollback())
 	}
 
-	for acctID, _ := range newAmounts {
-		event := strconv.FormatInt(acctID, 10)
-		util.PublishTopic(event, event)
+	for potID, newAmounts := range potAmounts {
+		for acctID := range newAmounts {
+			event := strconv.FormatInt(acctID, 10)
+			util.PublishTopic(event, event)
+		}
+		refreshInfo(potID)
 	}
-	util.Cache.Delete("info")
-	util.PublishTopic("", "info")
-	log.Println("Updated height to ", h)
+	transfersChecked()
+	transferLog.Info("updated height", "height", h)
+	return nil
 }
 
-func createNewEntries(tx *sql.Tx, newAmounts map[int64]uint64, newHeight uint64) error {
-	md := make(map[string]string)
-	rows, err := tx.Query(`SELECT key, value FROM metadata WHERE key IN ('entry_id', 'sign_key')`)
-	if err != nil {
-		return fmt.Errorf("createNewEntries select metadata error %v", err)
-	}
-	for rows.Next() {
-		var key, value string
-		if err := rows.Scan(&key, &value); err != nil {
-			return fmt.Errorf("createNewEntries scan key value error %v", err)
+// potAccountIndexes maps pot ids to their wallet account index, inactive pots too since their
+// accounts would otherwise take the indexes of the default pot's accounts
+func potAccountIndexes() (map[int64]uint64, error) {
+	var pots []Pot
+	if err := MustDB().Select(&pots, `SELECT * FROM pots`); err != nil {
+		return nil, fmt.Errorf("potAccountIndexes error %v", err)
+	}
+	indexes := make(map[int64]uint64)
+	for _, pot := range pots {
+		indexes[pot.ID] = pot.AccountIndex
+	}
+	return indexes, nil
+}
+
+// commitNewEntries creates the entries of every pot, moves the scanned height and commits
+func commitNewEntries(tx *sql.Tx, potAmounts map[int64]map[int64][]payment, newHeight uint64) error {
+	for potID, newAmounts := range potAmounts {
+		if err := createNewEntries(tx, potID, newAmounts); err != nil {
+			return err
 		}
-		md[key] = value
 	}
-	entryID, err := strconv.ParseInt(md["entry_id"], 10, 64)
+	_, err := tx.Exec(`UPDATE metadata SET value = $1 WHERE key = 'last_height'`, strconv.FormatUint(newHeight, 10))
 	if err != nil {
-		return fmt.Errorf("createNewEntries parse entry id error %v", err)
+		return fmt.Errorf("commitNewEntries update metadata error %v", err)
+	}
+	return tx.Commit()
+}
+
+// createNewEntries buys entries with the payments of each account in order, what's left of
+// a payment adds to the next one and stays on the account after the last
+func createNewEntries(tx *sql.Tx, potID int64, newAmounts map[int64][]payment) error {
+	var (
+		entryID int64
+		signKey string
+	)
+	row := tx.QueryRow(`SELECT entry_id, sign_key FROM pots WHERE id = $1`, potID)
+	if err := row.Scan(&entryID, &signKey); err != nil {
+		return fmt.Errorf("createNewEntries select pot error %v", err)
 	}
-	signKey := md["sign_key"]
-	log.Println("Current entry id", entryID)
-	for accountId, amount := range newAmounts {
+	transferLog.Debug("creating entries", "pot_id", potID, "entry_id", entryID)
+	for accountId, payments := range newAmounts {
+		var amount uint64
 		entries := 0
-		for {
-			if amount >= CurrentPrice {
-				amount -= CurrentPrice
-				entries++
+		for _, p := range payments {
+			amount += p.amount
+			bought := 0
+			for p.price > 0 && amount >= p.price {
+				amount -= p.price
+				bought++
 				entryID++
-				_, err := tx.Exec(`INSERT INTO entries (id, account_id, hash) VALUES ($1, $2, $3)`,
-					entryID, accountId, util.SignEntry(entryID, signKey))
+				_, err := tx.Exec(`INSERT INTO entries (pot_id, id, account_id, hash, tx_id) VALUES ($1, $2, $3, $4, $5)`,
+					potID, entryID, accountId, util.SignEntry(entryID, signKey), p.txid)
 				if err != nil {
 					return fmt.Errorf("createNewEntries insert entry error %v", err)
 				}
-			} else {
-				break
+			}
+			entries += bought
+			if p.txid != "" {
+				if _, err := tx.Exec(`UPDATE transactions SET price = $1, entries = $2 WHERE id = $3 AND account_id = $4`,
+					p.price, bought, p.txid, accountId); err != nil {
+					return fmt.Errorf("createNewEntries update transaction error %v", err)
+				}
 			}
 		}
 		_, err := tx.Exec(`UPDATE accounts SET amount = $1, entries = entries + $2 WHERE id = $3`, amount, entries, accountId)
@@ -167,14 +214,11 @@ func createNewEntries(tx *sql.Tx, newAmounts map[int64]uint64, newHeight uint64)
 			return fmt.Errorf("createNewEntries update amount error %v", err)
 		}
 	}
-	_, err = tx.Exec(`
-		UPDATE metadata SET value = $1 WHERE key = 'last_height';
-		UPDATE metadata SET value = $2 WHERE key = 'entry_id';`,
-		strconv.FormatUint(newHeight, 10), strconv.FormatInt(entryID, 10))
+	_, err := tx.Exec(`UPDATE pots SET entry_id = $1 WHERE id = $2`, entryID, potID)
 	if err != nil {
-		return fmt.Errorf("createNewEntries update metadata error %v", err)
+		return fmt.Errorf("createNewEntries update pot error %v", err)
 	}
-	return tx.Commit()
+	return nil
 }
 
 func entriesFromAmount(amount uint64) (int64, uint64) {
@@ -200,12 +244,52 @@ func RunBackground() {
 		panic(err)
 	}
 
-	// do price updates every 3AM
-	time.AfterFunc(AtHourMinute(3, 0), priceUpdate)
-	// pick winner every first of the month
-	pickWinnerTimer = time.AfterFunc(StartOfMonth(), runPickWinner)
+	jobs := []struct {
+		name string
+		expr string
+		run  func(at time.Time) error
+	}{
+		{CronPrice, util.Config.PriceSchedule, func(at time.Time) error {
+			return enqueueJob(MustDB(), JobPrice, at)
+		}},
+		{CronMissedTransfers, util.Config.MissedSchedule, func(at time.Time) error {
+			return CheckMissedTransfers()
+		}},
+		{CronBackup, util.Config.BackupSchedule, func(at time.Time) error {
+			doBackup()
+			return nil
+		}},
+		{CronPayouts, util.Config.PayoutSchedule, func(at time.Time) error {
+			return checkPayouts()
+		}},
+	}
+	for _, j := range jobs {
+		if err := ScheduleCron(j.name, j.expr, j.run); err != nil {
+			panic(err)
+		}
+	}
+	if len(daemons.nodes) > 1 {
+		if err := ScheduleCron(CronDaemons, util.Config.DaemonSchedule, func(at time.Time) error {
+			daemons.checkHealth()
+			return nil
+		}); err != nil {
+			panic(err)
+		}
+	}
+	// pick winners on each pot's schedule
+	pots, err := GetPots()
+	if err != nil {
+		panic(err)
+	}
+	for i := range pots {
+		if err := pots[i].scheduleDraw(); err != nil {
+			panic(err)
+		}
+	}
+
+	go runJobQueue()
 
-	log.Println("Started background task")
+	util.Log.Info("started background tasks")
 	for {
 		checkTransfers()
 		if util.Config.Production {
@@ -217,6 +301,15 @@ func RunBackground() {
 }
 
 func CheckMissedTransfers() error {
+	// read before the tx, the db only keeps a single connection
+	potIndexes, err := potAccountIndexes()
+	if err != nil {
+		return fmt.Errorf("CheckMissedTransfers: pots error %v", err)
+	}
+	history, err := GetEntryPrices()
+	if err != nil {
+		return fmt.Errorf("CheckMissedTransfers: entry prices error %v", err)
+	}
 	tx, err := MustDB().Begin()
 	if err != nil {
 		return fmt.Errorf("CheckMissedTransfers: error tx %v", err)
@@ -240,14 +333,13 @@ func CheckMissedTransfers() error {
 		return fmt.Errorf("CheckMissedTransfers: error last_height %v", err)
 	}
 
-	walletLock.Lock()
 	resp, err := Wallet.GetTransfers(&monerorpc.GetTransfersRequest{
 		In:             true,
 		FilterByHeight: true,
 		MinHeight:      h,
 		MaxHeight:      maxH,
+		AllAccounts:    true,
 	})
-	walletLock.Unlock()
 	if err != nil {
 		return fmt.Errorf("CheckMissedTransfers: error %v", err)
 	}
@@ -262,34 +354,45 @@ func CheckMissedTransfers() error {
 	}
 
 	var accounts []Account
-	if err != nil {
-		return fmt.Errorf("CheckMissedTransfers: error begin transaction %v", err)
-	}
-	rows, err := tx.Query(fmt.Sprintf(`SELECT id, address_index, address, user_name, user_address, amount, entries, active, ref_id
+	rows, err := tx.Query(fmt.Sprintf(`SELECT id, pot_id, address_index, address, user_name, user_address, amount, entries, active, ref_id
 		FROM accounts WHERE active = 1 AND address_index IN (%s)`, strings.Join(indexes, ",")))
 	if err != nil {
 		return fmt.Errorf("CheckMissedTransfers: query error %v", err)
 	}
-	accountTotal := make(map[uint64]uint64)
+	accountTotal := make(map[monerorpc.SubaddressIndex]uint64)
+	accountPayments := make(map[monerorpc.SubaddressIndex][]payment)
 	for rows.Next() {
 		account := Account{}
-		if err := rows.Scan(&account.ID, &account.AddressIndex, &account.Address, &account.UserName, &account.UserAddress, &account.Amount, &account.Entries, &account.Active, &account.RefID); err != nil {
+		if err := rows.Scan(&account.ID, &account.PotID, &account.AddressIndex, &account.Address, &account.UserName, &account.UserAddress, &account.Amount, &account.Entries, &account.Active, &account.RefID); err != nil {
 			return fmt.Errorf("CheckMissedTransfers: scan error %v", err)
 		}
+		potIndex, ok := potIndexes[account.PotID]
+		if !ok {
+			continue
+		}
 		accounts = append(accounts, account)
 		if !newVar && account.Amount > 0 {
 			// not first run so tally all, after will be tallied from current db amount
-			accountTotal[account.AddressIndex] = account.Amount
+			index := monerorpc.SubaddressIndex{Major: potIndex, Minor: account.AddressIndex}
+			accountTotal[index] = account.Amount
+			accountPayments[index] = []payment{{amount: account.Amount}}
 		}
 	}
-	newAmounts := make(map[int64]uint64)
+	byIndex := make(map[monerorpc.SubaddressIndex]*Account)
+	for i := range accounts {
+		account := &accounts[i]
+		byIndex[monerorpc.SubaddressIndex{Major: potIndexes[account.PotID], Minor: account.AddressIndex}] = account
+	}
+	potAmounts := make(map[int64]map[int64][]payment)
 	for _, t := range resp.In {
 		if t.Height > h {
 			h = t.Height
 		}
 
+		// a tx paying several addresses is a transfer for each, rows from before the ledger only have the txid
 		var txID string
-		row := tx.QueryRow(`SELECT id FROM transactions WHERE id = $1`, t.Txid)
+		row := tx.QueryRow(`SELECT id FROM transactions WHERE id = $1 AND ((account_index = $2 AND address_index = $3) OR source = '')`,
+			t.Txid, t.SubaddrIndex.Major, t.SubaddrIndex.Minor)
 		err := row.Scan(&txID)
 		if err != nil && err != sql.ErrNoRows {
 			return fmt.Errorf("CheckMissedTransfers: error select tx %v", err)
@@ -298,32 +401,43 @@ func CheckMissedTransfers() error {
 			continue // already processed
 		}
 
-		total, ok := accountTotal[t.SubaddrIndex.Minor]
+		total, ok := accountTotal[t.SubaddrIndex]
 		if !ok {
-			accountTotal[t.SubaddrIndex.Minor] = 0
+			accountTotal[t.SubaddrIndex] = 0
 		}
-		accountTotal[t.SubaddrIndex.Minor] = total + t.Amount
+		accountTotal[t.SubaddrIndex] = total + t.Amount
+		accountPayments[t.SubaddrIndex] = append(accountPayments[t.SubaddrIndex], payment{amount: t.Amount, price: priceAt(history, t.Timestamp), txid: t.Txid})
 
-		if _, err := tx.Exec(`INSERT INTO transactions (id) VALUES ($1)`, t.Txid); err != nil {
-			return fmt.Errorf("CheckMissedTransfers: insert tx error %v", err)
+		if err := recordTransaction(tx, t, byIndex[t.SubaddrIndex], TransactionMissed); err != nil {
+			return fmt.Errorf("CheckMissedTransfers: %v", err)
 		}
 	}
 	var missingEntries int64
 	for _, account := range accounts {
-		total, ok := accountTotal[account.AddressIndex]
+		potIndex, ok := potIndexes[account.PotID]
+		if !ok {
+			continue
+		}
+		index := monerorpc.SubaddressIndex{Major: potIndex, Minor: account.AddressIndex}
+		total, ok := accountTotal[index]
 		if !ok {
 			continue
 		}
+		newAmounts, ok := potAmounts[account.PotID]
+		if !ok {
+			newAmounts = make(map[int64][]payment)
+			potAmounts[account.PotID] = newAmounts
+		}
 		// initial fix would check against total entries but continous fix would only check against current balance
 		if newVar {
 			entries, amountLeft := entriesFromAmount(total)
 			if account.Entries < entries {
 				missingEntries += entries - account.Entries
-				newAmounts[account.ID] = uint64((entries-account.Entries)*int64(CurrentPrice)) + amountLeft
+				newAmounts[account.ID] = []payment{{amount: uint64((entries-account.Entries)*int64(CurrentPrice)) + amountLeft, price: CurrentPrice}}
 			}
 		} else if total > 0 && account.Amount < total {
 			// unaccounted totals that got missed
-			newAmounts[account.ID] = total
+			newAmounts[account.ID] = accountPayments[index]
 		}
 	}
 	sql := `UPDATE metadata SET value = $1 WHERE key = 'missed_height_check'`
@@ -333,60 +447,39 @@ func CheckMissedTransfers() error {
 	if _, err := tx.Exec(sql, h); err != nil {
 		return fmt.Errorf("CheckMissedTransfers: error metadata set %v", err)
 	}
-	if len(newAmounts) > 0 {
-		if err := createNewEntries(tx, newAmounts, h); err != nil {
+	if len(potAmounts) > 0 {
+		// keep the scanned height, missed checks only look behind it
+		if err := commitNewEntries(tx, potAmounts, maxH); err != nil {
 			return fmt.Errorf("CheckMissedTransfers: create entries error %v", err)
 		}
-		log.Println("Created missing entries: ", missingEntries)
+		transferLog.Info("created missing entries", "entries", missingEntries, "height", h)
 	} else {
 		return tx.Commit()
 	}
 	return nil
 }
 
-func priceUpdate() {
-	log.Printf("Updating price...")
+func priceUpdate() error {
+	priceLog.Info("updating price")
 	// make sure we get all missed transaction from last check (until we figure out how we are missing transactions)
 	if err := CheckMissedTransfers(); err != nil {
-		log.Println("Error check missed transfer", err)
-		time.AfterFunc(time.Minute*1, priceUpdate)
-		return
+		return fmt.Errorf("priceUpdate missed transfer error %v", err)
 	}
-	err := SetCurrentPrice()
-	if err != nil {
-		log.Println("Error updating price", err)
-		time.AfterFunc(time.Minute*1, priceUpdate)
-		return
+	// not SetCurrentPrice, the job retries while the last known price is used
+	if err := updateCurrentPrice(); err != nil {
+		return fmt.Errorf("priceUpdate error %v", err)
 	}
-	time.AfterFunc(AtHourMinute(0, 40), priceUpdate)
-}
-
-func AtHourMinute(hour int, minute int) time.Duration {
-	t := util.UtcNow()
-	n := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, t.Location())
-	if t.After(n) {
-		n = n.Add(24 * time.Hour)
-	}
-	d := n.Sub(t)
-	return d
-}
-
-func StartOfMonth() time.Duration {
-	now := util.UtcNow()
-	year, month, _ := now.Date()
-	addMonth := time.Month(1)
-	return time.Date(year, month+addMonth, 1, 0, 5, 0, 0, now.Location()).Sub(now)
+	return nil
 }
 
-// database backups every 11:30PM
+// database backups on start and then on the backup schedule
 func doBackup() {
-	defer time.AfterFunc(AtHourMinute(23, 30), doBackup)
 	if !util.FileExists(dbPath) {
 		return
 	}
 	backupDir := filepath.Join(util.Config.DataPath, "backups")
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		log.Printf("Failed to create backup dir: %v", err)
+		dbLog.Error("create backup dir failed", "error", err)
 		return
 	}
 	backupPath := filepath.Join(backupDir, util.UtcNow().Format(SDateTimeFormat)+".db")
@@ -396,15 +489,15 @@ func doBackup() {
 			dbx.Close()
 			dbx = nil
 		}
-		log.Printf("Backing up db %s to %s", dbPath, backupPath)
+		dbLog.Info("backing up db", "path", dbPath, "backup", backupPath)
 		if err := util.CopyFile(dbPath, backupPath); err != nil {
-			log.Printf("Failed to copy backup db: %v", err)
+			dbLog.Error("copy backup db failed", "error", err)
 		}
 		dbLock.Unlock()
 
 		bkFiles, err := ioutil.ReadDir(backupDir)
 		if err != nil {
-			log.Println("Failed to read dir", err)
+			dbLog.Error("read backup dir failed", "error", err)
 			return
 		}
 
@@ -413,7 +506,7 @@ func doBackup() {
 				if time.Since(file.ModTime()) > time.Hour*24*60 {
 					p := filepath.Join(backupDir, file.Name())
 					if err := os.Remove(p); err != nil {
-						log.Println("Failed delete file", file.Name(), err)
+						dbLog.Error("delete backup failed", "file", file.Name(), "error", err)
 					}
 				}
 			}
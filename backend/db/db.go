@@ -2,12 +2,12 @@ package db
 
 import (
 	"fmt"
-	"log"
 	"moneropot/monerorpc"
 	"moneropot/util"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/gabstv/httpdigest"
@@ -17,6 +17,7 @@ import (
 
 var (
 	dbLock       sync.Mutex
+	lockedEvents []string
 	dbx          *sqlx.DB
 	dbPath       string
 	CurrentPrice uint64
@@ -24,36 +25,88 @@ var (
 	DateFormat      = "2006-01-02"
 	DateTimeFormat  = "2006-01-02 15:04:05"
 	SDateTimeFormat = "2006-01-02T15:04:05.000Z"
+
+	// component loggers, lines add the pot_id, month, account_id, txid or height they're about
+	dbLog       = util.Log.With("component", "db")
+	transferLog = util.Log.With("component", "transfers")
+	drawLog     = util.Log.With("component", "draw")
+	payoutLog   = util.Log.With("component", "payout")
+	jobLog      = util.Log.With("component", "jobs")
+	cronLog     = util.Log.With("component", "cron")
+	daemonLog   = util.Log.With("component", "daemons")
+	priceLog    = util.Log.With("component", "price")
+	walletLog   = util.Log.With("component", "wallet")
 )
 
 func Init() {
 	if err := os.MkdirAll(util.Config.DataPath, 0755); err != nil {
-		log.Fatal(err)
+		dbLog.Fatal("create data path failed", "error", err)
 	}
 	dbPath = filepath.Join(util.Config.DataPath, util.Config.DbName)
 	if util.Config.DbName == ":memory:" {
 		dbPath = util.Config.DbName
 	}
-	Wallet = monerorpc.New(monerorpc.Config{
-		Address:   util.Config.RpcAddress,
-		Transport: httpdigest.New(util.Config.RpcUser, util.Config.RpcPass),
-	})
-	Daemon = monerorpc.New(monerorpc.Config{
-		Address:   util.Config.DaemonAddress,
-		Transport: httpdigest.New(util.Config.DaemonUser, util.Config.DaemonPass),
-	})
+	var chains []ChainEndpoint
+	for _, address := range strings.Split(util.Config.DaemonAddress, ",") {
+		address = strings.TrimSpace(address)
+		chains = append(chains, ChainEndpoint{
+			Name: EndpointName(address),
+			Chain: monerorpc.New(monerorpc.Config{
+				Address:     address,
+				Transport:   httpdigest.New(util.Config.DaemonUser, util.Config.DaemonPass),
+				Timeout:     util.Config.RpcTimeout,
+				SendTimeout: util.Config.RpcSendTimeout,
+				Retries:     util.Config.RpcRetries,
+				Observe:     observeRPC("daemon"),
+			}),
+		})
+	}
+	SetBackends(monerorpc.New(monerorpc.Config{
+		Address:     util.Config.RpcAddress,
+		Transport:   httpdigest.New(util.Config.RpcUser, util.Config.RpcPass),
+		Timeout:     util.Config.RpcTimeout,
+		SendTimeout: util.Config.RpcSendTimeout,
+		Retries:     util.Config.RpcRetries,
+		Observe:     observeRPC("wallet"),
+	}), chains...)
 	// backup if already exists on every update then every 24 hours
 	doBackup()
 	MustDB()
+	util.EventQueue = queueEvent
+	pots, err := GetPots()
+	if err != nil {
+		dbLog.Fatal("load pots failed", "error", err)
+	}
+	for i := range pots {
+		if err := pots[i].initSignCommit(); err != nil {
+			dbLog.Fatal("sign commit failed", "pot_id", pots[i].ID, "error", err)
+		}
+	}
 	if err := SetCurrentPrice(); err != nil {
-		log.Fatal(err)
+		priceLog.Fatal("set price failed", "error", err)
+	}
+}
+
+// lockedEvent holds an event raised while dbLock is held, queueing it needs the db so
+// unlockDB sends it once the lock is released
+func lockedEvent(msg string) {
+	lockedEvents = append(lockedEvents, msg)
+}
+
+// unlockDB releases dbLock and sends the events raised while it was held
+func unlockDB() {
+	events := lockedEvents
+	lockedEvents = nil
+	dbLock.Unlock()
+	for _, msg := range events {
+		util.SendEvent(msg)
 	}
 }
 
 func MustDB() *sqlx.DB {
 	db, err := GetDB()
 	if err != nil {
-		log.Fatal(err)
+		dbLog.Fatal("open db failed", "error", err)
 	}
 	return db
 }
@@ -64,7 +117,7 @@ func GetDB() (*sqlx.DB, error) {
 	if dbx != nil {
 		return dbx, nil
 	}
-	log.Printf("Opening %s", dbPath)
+	dbLog.Info("opening db", "path", dbPath)
 	db, err := sqlx.Open("sqlite3", dbPath)
 	db.SetMaxOpenConns(1)
 	if err != nil {
@@ -95,18 +148,18 @@ func GetDB() (*sqlx.DB, error) {
 		for i := version; i < tdb; i++ {
 			_, err = tx.Exec(dbMigrations[i])
 			if err != nil {
-				log.Println("RollbackError: migration ", tx.Rollback())
+				dbLog.Error("migration rollback", "migration", i, "error", tx.Rollback())
 				return nil, fmt.Errorf("GetDB tx.Exec migrations error: %d -> %v", i, err)
 			}
 		}
 		if _, err := tx.Exec(`UPDATE metadata SET value = $1 WHERE key = 'db_version'`, strconv.Itoa(tdb)); err != nil {
-			log.Println("RollbackError: version update ", tx.Rollback())
+			dbLog.Error("version update rollback", "error", tx.Rollback())
 			return nil, fmt.Errorf("GetDB tx.Exec set version error: %v", err)
 		}
 		if err := tx.Commit(); err != nil {
 			return nil, fmt.Errorf("GetDB tx.Commit error: %v", err)
 		}
-		log.Printf("Migrated db to %d", tdb)
+		dbLog.Info("migrated db", "version", tdb)
 	}
 	return db, nil
 }
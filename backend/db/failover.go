@@ -0,0 +1,238 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"moneropot/monerorpc"
+	"moneropot/util"
+)
+
+type (
+	// ChainEndpoint is one daemon, Name is shown in /api/info so keep credentials out of it
+	ChainEndpoint struct {
+		Name  string
+		Chain ChainBackend
+	}
+
+	chainNode struct {
+		ChainEndpoint
+		healthy   bool
+		height    uint64
+		lastError string
+		checkedAt time.Time
+	}
+
+	// failoverChain sends calls to the active daemon and moves on to the next one when it fails
+	failoverChain struct {
+		mu     sync.Mutex
+		nodes  []*chainNode
+		active int
+	}
+
+	// DaemonStatus is the last health check of a daemon
+	DaemonStatus struct {
+		Name      string    `json:"name"`
+		Active    bool      `json:"active"`
+		Healthy   bool      `json:"healthy"`
+		Height    uint64    `json:"height"`
+		LastError string    `json:"last_error,omitempty"`
+		CheckedAt time.Time `json:"checked_at"`
+	}
+)
+
+const (
+	CronDaemons = "daemons"
+
+	// a daemon this many blocks behind the best one is treated as down
+	maxHeightLag = 10
+)
+
+var (
+	daemons *failoverChain
+)
+
+// EndpointName is the scheme and host of an rpc address
+func EndpointName(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return address
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func newFailoverChain(endpoints []ChainEndpoint) *failoverChain {
+	f := &failoverChain{}
+	for _, e := range endpoints {
+		f.nodes = append(f.nodes, &chainNode{
+			ChainEndpoint: ChainEndpoint{Name: e.Name, Chain: &lockedChain{chain: e.Chain}},
+			healthy:       true,
+		})
+	}
+	return f
+}
+
+// try runs call on the active daemon first then the other healthy ones then the rest
+func (f *failoverChain) try(call func(chain ChainBackend) error) error {
+	f.mu.Lock()
+	order := make([]int, 0, len(f.nodes))
+	order = append(order, f.active)
+	for _, healthy := range []bool{true, false} {
+		for i, n := range f.nodes {
+			if i != f.active && n.healthy == healthy {
+				order = append(order, i)
+			}
+		}
+	}
+	f.mu.Unlock()
+	var err error
+	for _, i := range order {
+		n := f.nodes[i]
+		if err = call(n.Chain); err == nil {
+			f.mu.Lock()
+			n.healthy = true
+			if f.active != i {
+				daemonLog.Warn("switched daemon", "daemon", n.Name)
+				f.active = i
+			}
+			f.mu.Unlock()
+			return nil
+		}
+		daemonLog.Error("daemon call failed", "daemon", n.Name, "error", err)
+		f.mu.Lock()
+		n.healthy = false
+		n.lastError = err.Error()
+		f.mu.Unlock()
+	}
+	return err
+}
+
+func (f *failoverChain) GetLastBlockHeader() (*monerorpc.GetLastBlockHeaderResponse, error) {
+	var resp *monerorpc.GetLastBlockHeaderResponse
+	err := f.try(func(chain ChainBackend) (err error) {
+		resp, err = chain.GetLastBlockHeader()
+		return
+	})
+	return resp, err
+}
+
+func (f *failoverChain) GetBlockHeadersRange(req *monerorpc.GetBlockHeadersRangeRequest) (*monerorpc.GetLastBlockHeadersRangeResponse, error) {
+	var resp *monerorpc.GetLastBlockHeadersRangeResponse
+	err := f.try(func(chain ChainBackend) (err error) {
+		resp, err = chain.GetBlockHeadersRange(req)
+		return
+	})
+	return resp, err
+}
+
+// checkHealth asks every daemon for its tip, the active one is replaced when it's down or
+// lagging behind so the next draw doesn't have to fail first
+func (f *failoverChain) checkHealth() {
+	var best uint64
+	for _, n := range f.nodes {
+		bh, err := n.Chain.GetLastBlockHeader()
+		f.mu.Lock()
+		n.checkedAt = util.UtcNow()
+		n.healthy = err == nil
+		if err != nil {
+			n.lastError = err.Error()
+		} else {
+			n.lastError = ""
+			n.height = bh.BlockHeader.Height
+			if n.height > best {
+				best = n.height
+			}
+		}
+		f.mu.Unlock()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, n := range f.nodes {
+		if n.healthy && n.height+maxHeightLag < best {
+			n.healthy = false
+			n.lastError = fmt.Sprintf("height %d is behind %d", n.height, best)
+		}
+	}
+	if f.nodes[f.active].healthy {
+		return
+	}
+	for i, n := range f.nodes {
+		if n.healthy {
+			daemonLog.Warn("switched daemon", "daemon", n.Name, "from", f.nodes[f.active].Name, "error", f.nodes[f.active].lastError)
+			f.active = i
+			return
+		}
+	}
+	util.SendEvent("checkHealth every daemon is down")
+}
+
+// ActiveDaemon is the name of the daemon calls go to
+func ActiveDaemon() string {
+	if daemons == nil || len(daemons.nodes) == 0 {
+		return ""
+	}
+	daemons.mu.Lock()
+	defer daemons.mu.Unlock()
+	return daemons.nodes[daemons.active].Name
+}
+
+func GetDaemonStatus() []DaemonStatus {
+	status := []DaemonStatus{}
+	if daemons == nil {
+		return status
+	}
+	daemons.mu.Lock()
+	defer daemons.mu.Unlock()
+	for i, n := range daemons.nodes {
+		status = append(status, DaemonStatus{
+			Name:      n.Name,
+			Active:    i == daemons.active,
+			Healthy:   n.healthy,
+			Height:    n.height,
+			LastError: n.lastError,
+			CheckedAt: n.checkedAt,
+		})
+	}
+	return status
+}
+
+// confirmFirstBlock has other daemons look up the first block of the draw, a daemon on a fork
+// or a lying remote node would otherwise pick the winner alone, it runs with the draw holding dbLock
+func confirmFirstBlock(start time.Time, hash string) error {
+	if daemons == nil {
+		return nil
+	}
+	need := util.Config.DaemonQuorum
+	if need > len(daemons.nodes) {
+		need = len(daemons.nodes)
+	}
+	daemons.mu.Lock()
+	active := daemons.active
+	daemons.mu.Unlock()
+	agree := 1
+	for i, n := range daemons.nodes {
+		if agree >= need {
+			return nil
+		}
+		if i == active {
+			continue
+		}
+		other, err := firstBlockAfter(n.Chain, start)
+		if err != nil {
+			daemonLog.Error("confirm first block failed", "daemon", n.Name, "month", start.Format(DateFormat), "error", err)
+			continue
+		}
+		if other != hash {
+			lockedEvent(fmt.Sprintf("Daemons disagree on the first block after %s\n%s: %s\n%s: %s",
+				start.Format(DateTimeFormat), daemons.nodes[active].Name, hash, n.Name, other))
+			return fmt.Errorf("confirmFirstBlock %s has %s not %s", n.Name, other, hash)
+		}
+		agree++
+	}
+	if agree < need {
+		return fmt.Errorf("confirmFirstBlock only %d of %d daemons confirmed %s", agree, need, hash)
+	}
+	return nil
+}
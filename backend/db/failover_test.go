@@ -0,0 +1,59 @@
+package db
+
+import (
+	"moneropot/monerorpc/fake"
+	"moneropot/util"
+	"testing"
+	"time"
+)
+
+func TestFailoverChain(t *testing.T) {
+	down, backup, other := fake.New(), fake.New(), fake.New()
+	defer backup.Close()
+	defer other.Close()
+	down.Close()
+	f := newFailoverChain([]ChainEndpoint{
+		{Name: "down", Chain: down.Client()},
+		{Name: "backup", Chain: backup.Client()},
+		{Name: "other", Chain: other.Client()},
+	})
+	if _, err := f.GetLastBlockHeader(); err != nil {
+		t.Fatalf("Wanted failover to backup got %v", err)
+	}
+	if f.active != 1 || f.nodes[0].healthy {
+		t.Errorf("Wanted backup active and down unhealthy got %d %v", f.active, f.nodes[0].healthy)
+	}
+
+	// a lagging daemon is as good as down
+	bh, _ := backup.Client().GetLastBlockHeader()
+	backup.SetTip(bh.BlockHeader.Height-maxHeightLag-1, bh.BlockHeader.Timestamp-(maxHeightLag+1)*fake.BlockTime)
+	f.checkHealth()
+	if f.active != 2 || f.nodes[1].healthy {
+		t.Errorf("Wanted other active and backup lagging got %d %v", f.active, f.nodes[1].lastError)
+	}
+	backup.SetTip(bh.BlockHeader.Height, bh.BlockHeader.Timestamp)
+
+	saved, savedQuorum := daemons, util.Config.DaemonQuorum
+	defer func() {
+		daemons, util.Config.DaemonQuorum = saved, savedQuorum
+	}()
+	daemons = f
+	util.Config.DaemonQuorum = 2
+	start := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	hash, err := firstBlockAfter(f, start)
+	if err != nil {
+		t.Fatalf("first block error %v", err)
+	}
+	if err := confirmFirstBlock(start, hash); err != nil {
+		t.Errorf("Wanted daemons to agree got %v", err)
+	}
+	backup.SetBlockHash(backup.HeightAt(uint64(start.Unix())), "fork")
+	if err := confirmFirstBlock(start, hash); err == nil {
+		t.Errorf("Wanted daemons to disagree")
+	}
+	util.Config.DaemonQuorum = 4
+	backup.SetBlockHash(backup.HeightAt(uint64(start.Unix())), hash)
+	if err := confirmFirstBlock(start, hash); err == nil {
+		t.Errorf("Wanted too few daemons to confirm")
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"moneropot/util"
+)
+
+type (
+	// HealthCheck is the result of one check, Age is in seconds
+	HealthCheck struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+		Height uint64 `json:"height,omitempty"`
+		Lag    int64  `json:"lag,omitempty"`
+		Age    int64  `json:"age,omitempty"`
+	}
+
+	Health struct {
+		Status string                 `json:"status"`
+		Checks map[string]HealthCheck `json:"checks"`
+	}
+)
+
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+
+	lastTransferCheckKey = "last_transfer_check"
+)
+
+// transfersChecked keeps when incoming transfers were last scanned without errors
+func transfersChecked() {
+	if err := SetMetadata(lastTransferCheckKey, util.UtcNow().Format(time.RFC3339)); err != nil {
+		transferLog.Error("save transfer check failed", "error", err)
+	}
+}
+
+func (h *Health) add(name string, c HealthCheck, err error) {
+	c.Status = HealthOK
+	if err != nil {
+		c.Status = HealthFail
+		c.Error = err.Error()
+		h.Status = HealthFail
+	}
+	h.Checks[name] = c
+}
+
+// CheckHealth checks the database can be written, ready also checks the wallet, daemon,
+// transfer scans and price are all working and current
+func CheckHealth(ready bool) *Health {
+	h := &Health{Status: HealthOK, Checks: make(map[string]HealthCheck)}
+	h.add("db", HealthCheck{}, SetMetadata("health_check", util.UtcNow().Format(time.RFC3339)))
+	if !ready {
+		return h
+	}
+
+	wc := HealthCheck{}
+	wh, err := Wallet.GetHeight()
+	if err == nil {
+		wc.Height = wh.Height
+	}
+	h.add("wallet", wc, err)
+
+	dc := HealthCheck{}
+	bh, err := Daemon.GetLastBlockHeader()
+	if err == nil {
+		// the wallet height counts blocks, one more than the top block height
+		dc.Height = bh.BlockHeader.Height + 1
+		if wh != nil {
+			dc.Lag = int64(dc.Height) - int64(wh.Height)
+			if dc.Lag > int64(util.Config.HealthMaxLag) {
+				err = fmt.Errorf("wallet is %d blocks behind", dc.Lag)
+			}
+		}
+	}
+	h.add("daemon", dc, err)
+
+	tc := HealthCheck{}
+	err = nil
+	if at, gerr := GetMetadata(lastTransferCheckKey, ""); gerr != nil {
+		err = gerr
+	} else if t, perr := time.Parse(time.RFC3339, at); perr != nil {
+		err = fmt.Errorf("transfers not checked yet")
+	} else {
+		tc.Age = int64(util.UtcNow().Sub(t).Seconds())
+		if util.UtcNow().Sub(t) > util.Config.HealthScanAge {
+			err = fmt.Errorf("transfers last checked %s", at)
+		}
+	}
+	h.add("transfers", tc, err)
+
+	pc := HealthCheck{}
+	err = nil
+	// a fixed entry price is never outdated
+	if !util.FixedPrice() {
+		if price, gerr := GetMetadata(currentPriceKey, ""); gerr != nil {
+			err = gerr
+		} else if t, perr := time.Parse(DateFormat, strings.Split(price, ":")[0]); perr != nil {
+			err = fmt.Errorf("no price yet")
+		} else {
+			pc.Age = int64(util.UtcNow().Sub(t).Seconds())
+			if util.UtcNow().Sub(t) > util.Config.HealthPriceAge {
+				err = fmt.Errorf("price is from %s", t.Format(DateFormat))
+			}
+		}
+	}
+	h.add("price", pc, err)
+	return h
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"moneropot/util"
+	"testing"
+	"time"
+)
+
+func TestCheckHealth(t *testing.T) {
+	now := util.Now
+	defer func() {
+		util.Now = now
+	}()
+	util.Now = func() time.Time {
+		return time.Date(2021, 11, 20, 12, 0, 0, 0, time.UTC)
+	}
+	if h := CheckHealth(false); h.Status != HealthOK || len(h.Checks) != 1 {
+		t.Errorf("Wanted healthy db only got %v", h)
+	}
+	SetMetadata(lastTransferCheckKey, "")
+	SetMetadata("current_price", "2021-11-20:1000")
+	h := CheckHealth(true)
+	if h.Status != HealthFail || h.Checks["transfers"].Status != HealthFail {
+		t.Errorf("Wanted transfers not checked got %v", h)
+	}
+	checkTransfers()
+	h = CheckHealth(true)
+	for _, name := range []string{"db", "wallet", "daemon", "transfers", "price"} {
+		if h.Checks[name].Status != HealthOK {
+			t.Errorf("Wanted %s ok got %v", name, h.Checks[name])
+		}
+	}
+	if h.Status != HealthOK || h.Checks["daemon"].Lag != 0 || h.Checks["price"].Age != 12*3600 {
+		t.Errorf("Wanted ready got %v", h)
+	}
+	SetMetadata("current_price", "2021-11-17:1000")
+	if h := CheckHealth(true); h.Status != HealthFail || h.Checks["price"].Status != HealthFail {
+		t.Errorf("Wanted stale price got %v", h.Checks["price"])
+	}
+}
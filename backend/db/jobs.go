@@ -0,0 +1,265 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"moneropot/util"
+)
+
+type (
+	// Job is a queued unit of work retried with exponential backoff until it
+	// succeeds or runs out of attempts and is left dead for an admin to retry
+	Job struct {
+		ID          int64   `json:"id" db:"id"`
+		Type        string  `json:"type" db:"type"`
+		Payload     string  `json:"payload" db:"payload"`
+		Status      string  `json:"status" db:"status"`
+		Attempts    int     `json:"attempts" db:"attempts"`
+		MaxAttempts int     `json:"max_attempts" db:"max_attempts"`
+		NextRun     int64   `json:"next_run" db:"next_run"`
+		LastError   *string `json:"last_error" db:"last_error"`
+		CreatedAt   int64   `json:"created_at" db:"created_at"`
+		UpdatedAt   int64   `json:"updated_at" db:"updated_at"`
+	}
+
+	drawPayload struct {
+		PotID int64     `json:"pot_id"`
+		At    time.Time `json:"at"`
+	}
+
+	payoutPayload struct {
+		PotID int64  `json:"pot_id"`
+		Date  string `json:"date"`
+	}
+
+	execer interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	}
+)
+
+const (
+	JobDraw   = "draw"
+	JobPayout = "payout"
+	JobPrice  = "price"
+	JobEvent  = "event"
+
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead"
+
+	maxJobBackoff = time.Hour * 6
+)
+
+var (
+	// payouts move money so they give up sooner and wait for an admin
+	jobMaxAttempts = map[string]int{
+		JobDraw:   10,
+		JobPayout: 5,
+		JobPrice:  10,
+		JobEvent:  10,
+	}
+	jobHandlers = map[string]func(payload string) error{
+		JobDraw:   runDrawJob,
+		JobPayout: runPayoutJob,
+		JobPrice:  runPriceJob,
+		JobEvent:  runEventJob,
+	}
+	jobWake = make(chan bool, 1)
+
+	ErrJobNotFound = fmt.Errorf("job not found or not retryable")
+)
+
+// enqueueJob adds a job unless the same one is already waiting, ex can be a tx so the job
+// is only queued when the work that needs it commits
+func enqueueJob(ex execer, jobType string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("enqueueJob marshal error %v", err)
+	}
+	now := util.UtcNow().Unix()
+	if _, err := ex.Exec(`INSERT INTO jobs (type, payload, status, max_attempts, next_run, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, $5, $5
+		WHERE NOT EXISTS (SELECT 1 FROM jobs WHERE type = $1 AND payload = $2 AND status IN ($3, $6))`,
+		jobType, string(b), JobPending, jobMaxAttempts[jobType], now, JobRunning); err != nil {
+		return fmt.Errorf("enqueueJob error %v", err)
+	}
+	select {
+	case jobWake <- true:
+	default:
+	}
+	return nil
+}
+
+// jobBackoff doubles the wait from a minute on every failed attempt
+func jobBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return maxJobBackoff
+	}
+	d := time.Minute << uint(attempts-1)
+	if d > maxJobBackoff {
+		return maxJobBackoff
+	}
+	return d
+}
+
+// nextDueJob claims the oldest due job
+func nextDueJob() (*Job, error) {
+	db := MustDB()
+	j := &Job{}
+	now := util.UtcNow().Unix()
+	if err := db.Get(j, `SELECT * FROM jobs WHERE status = $1 AND next_run <= $2 ORDER BY next_run, id LIMIT 1`,
+		JobPending, now); err != nil {
+		if util.NoRows(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("nextDueJob error %v", err)
+	}
+	j.Attempts++
+	j.Status = JobRunning
+	if _, err := db.Exec(`UPDATE jobs SET status = $1, attempts = $2, updated_at = $3 WHERE id = $4`,
+		j.Status, j.Attempts, now, j.ID); err != nil {
+		return nil, fmt.Errorf("nextDueJob claim error %v", err)
+	}
+	return j, nil
+}
+
+func runQueuedJob(j *Job) {
+	handler, ok := jobHandlers[j.Type]
+	err := fmt.Errorf("unknown job type %s", j.Type)
+	if ok {
+		err = handler(j.Payload)
+	}
+	now := util.UtcNow()
+	if err == nil {
+		j.Status = JobDone
+		j.LastError = nil
+		jobLog.Info("job done", "job_id", j.ID, "type", j.Type, "attempt", j.Attempts)
+	} else {
+		msg := err.Error()
+		j.LastError = &msg
+		j.Status = JobPending
+		j.NextRun = now.Add(jobBackoff(j.Attempts)).Unix()
+		if j.Attempts >= j.MaxAttempts {
+			j.Status = JobDead
+		}
+		jobLog.Error("job failed", "job_id", j.ID, "type", j.Type, "attempt", j.Attempts, "max_attempts", j.MaxAttempts, "error", err)
+	}
+	jobsRun.Inc(j.Type, j.Status)
+	db := MustDB()
+	if _, err := db.Exec(`UPDATE jobs SET status = $1, next_run = $2, last_error = $3, updated_at = $4 WHERE id = $5`,
+		j.Status, j.NextRun, j.LastError, now.Unix(), j.ID); err != nil {
+		jobLog.Error("update job failed", "job_id", j.ID, "error", err)
+	}
+	if j.Status == JobDead && j.Type != JobEvent {
+		util.SendEvent(fmt.Sprintf("Job %d %s is dead after %d attempts\nPayload: %s\nError: %s",
+			j.ID, j.Type, j.Attempts, j.Payload, *j.LastError))
+	}
+}
+
+// processJobs runs every due job one at a time
+func processJobs() {
+	for {
+		j, err := nextDueJob()
+		if err != nil {
+			jobLog.Error("next job failed", "error", err)
+			return
+		}
+		if j == nil {
+			return
+		}
+		runQueuedJob(j)
+	}
+}
+
+// runJobQueue is the single job worker, jobs left running by a restart are picked up again
+func runJobQueue() {
+	db := MustDB()
+	if _, err := db.Exec(`UPDATE jobs SET status = $1 WHERE status = $2`, JobPending, JobRunning); err != nil {
+		jobLog.Error("reset running jobs failed", "error", err)
+	}
+	for {
+		processJobs()
+		select {
+		case <-jobWake:
+		case <-time.After(time.Second * 10):
+		}
+	}
+}
+
+func GetJobs(status string, page int) ([]Job, error) {
+	db := MustDB()
+	jobs := []Job{}
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * 50
+	var err error
+	if status == "" {
+		err = db.Select(&jobs, `SELECT * FROM jobs ORDER BY id DESC LIMIT 50 OFFSET $1`, offset)
+	} else {
+		err = db.Select(&jobs, `SELECT * FROM jobs WHERE status = $1 ORDER BY id DESC LIMIT 50 OFFSET $2`, status, offset)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetJobs error %v", err)
+	}
+	return jobs, nil
+}
+
+// RetryJob gives a failed or dead job a fresh set of attempts and runs it next
+func RetryJob(id int64) error {
+	db := MustDB()
+	r, err := db.Exec(`UPDATE jobs SET status = $1, attempts = 0, next_run = $2, updated_at = $2
+		WHERE id = $3 AND status IN ($1, $4)`, JobPending, util.UtcNow().Unix(), id, JobDead)
+	if err != nil {
+		return fmt.Errorf("RetryJob error %v", err)
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return ErrJobNotFound
+	}
+	select {
+	case jobWake <- true:
+	default:
+	}
+	return nil
+}
+
+func runDrawJob(payload string) error {
+	p := &drawPayload{}
+	if err := json.Unmarshal([]byte(payload), p); err != nil {
+		return err
+	}
+	return runPickWinner(p.PotID, p.At)
+}
+
+func runPayoutJob(payload string) error {
+	p := &payoutPayload{}
+	if err := json.Unmarshal([]byte(payload), p); err != nil {
+		return err
+	}
+	pot, err := GetPot(p.PotID)
+	if err != nil {
+		return err
+	}
+	return transferWinner(pot, p.Date)
+}
+
+func runPriceJob(payload string) error {
+	return priceUpdate()
+}
+
+func runEventJob(payload string) error {
+	var msg string
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		return err
+	}
+	return util.MailEvent(msg)
+}
+
+// queueEvent persists notifications so failed emails are retried with backoff
+func queueEvent(msg string) error {
+	return enqueueJob(MustDB(), JobEvent, msg)
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, time.Minute * 2},
+		{5, time.Minute * 16},
+		{9, time.Hour*4 + time.Minute*16},
+		{10, maxJobBackoff},
+		{50, maxJobBackoff},
+	}
+	for _, tt := range tests {
+		if got := jobBackoff(tt.attempts); got != tt.want {
+			t.Errorf("attempts %d wanted %v got %v", tt.attempts, tt.want, got)
+		}
+	}
+}
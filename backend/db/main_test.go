@@ -0,0 +1,26 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"moneropot/monerorpc/fake"
+	"moneropot/util"
+)
+
+var fakeRPC *fake.Server
+
+// TestMain runs every db test against one in memory database and a fake wallet and daemon
+func TestMain(m *testing.M) {
+	fakeRPC = fake.New()
+	os.Setenv("DB_NAME", ":memory:")
+	os.Setenv("RPC_ADDRESS", fakeRPC.Address())
+	os.Setenv("DAEMON_ADDRESS", fakeRPC.Address())
+	os.Setenv("PRICE_SOURCES", "static")
+	os.Setenv("PRICE_STATIC", "250")
+	util.ParseArgs()
+	Init()
+	code := m.Run()
+	fakeRPC.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"strconv"
+	"time"
+
+	"moneropot/monerorpc"
+	"moneropot/util"
+)
+
+var (
+	rpcDuration = util.NewHistogram("moneropot_rpc_duration_seconds", "Wallet and daemon rpc call latency.",
+		util.DefaultBuckets, "client", "method")
+	rpcErrors = util.NewCounter("moneropot_rpc_errors_total", "Wallet and daemon rpc calls that failed.", "client", "method")
+
+	checkTransfersRuns   = util.NewCounter("moneropot_check_transfers_total", "Incoming transfer scans.")
+	checkTransfersErrors = util.NewCounter("moneropot_check_transfers_errors_total", "Incoming transfer scans that failed.")
+	jobsRun              = util.NewCounter("moneropot_jobs_total", "Queued jobs run by type and resulting status.", "type", "status")
+
+	potBalance         = util.NewGauge("moneropot_pot_balance_xmr", "Wallet balance of the pot.", "pot")
+	potUnlockedBalance = util.NewGauge("moneropot_pot_unlocked_balance_xmr", "Unlocked wallet balance of the pot.", "pot")
+	potEntries         = util.NewGauge("moneropot_pot_entries", "Entries in the current draw of the pot.", "pot")
+	potActiveAccounts  = util.NewGauge("moneropot_pot_active_accounts", "Accounts with a payment in the current draw of the pot.", "pot")
+	entryPrice         = util.NewGauge("moneropot_entry_price_xmr", "Current price of an entry.")
+	xmrRate            = util.NewGauge("moneropot_xmr_rate", "XMR rate in the fiat currency the entry price was set from.", "currency")
+	scannedHeight      = util.NewGauge("moneropot_scanned_height", "Height incoming transfers were scanned to.")
+)
+
+func init() {
+	util.RegisterCollector(collectMetrics)
+}
+
+// observeRPC times every monerorpc call of client
+func observeRPC(client string) func(method string, d time.Duration, err error) {
+	return func(method string, d time.Duration, err error) {
+		rpcDuration.Observe(d.Seconds(), client, method)
+		if err != nil {
+			rpcErrors.Inc(client, method)
+		}
+	}
+}
+
+// collectMetrics sets the price gauges on every scrape, the pot gauges are kept by updatePotMetrics
+// so a scrape never waits on the wallet or the db during a draw or payout
+func collectMetrics() {
+	if dbx == nil || Wallet == nil {
+		return
+	}
+	entryPrice.Set(monerorpc.XMRToFloat64(CurrentPrice))
+	if !util.FixedPrice() {
+		xmrRate.Set(float64(util.XmrPrice)/1e8, util.FiatCurrency())
+	}
+}
+
+// updatePotMetrics reads the balance, entries and accounts of every pot and the scanned height,
+// it runs once the wallet is synced and after every transfer scan
+func updatePotMetrics() {
+	if h, err := LastHeight(); err == nil {
+		scannedHeight.Set(float64(h))
+	}
+	pots, err := GetPots()
+	if err != nil {
+		dbLog.Error("update metrics failed", "error", err)
+		return
+	}
+	for i := range pots {
+		pot := &pots[i]
+		id := strconv.FormatInt(pot.ID, 10)
+		if b, err := Wallet.GetBalance(&monerorpc.GetBalanceRequest{AccountIndex: pot.AccountIndex}); err == nil {
+			potBalance.Set(monerorpc.XMRToFloat64(b.Balance), id)
+			potUnlockedBalance.Set(monerorpc.XMRToFloat64(b.UnlockedBalance), id)
+		}
+		potEntries.Set(float64(pot.EntryID), id)
+		var active int64
+		if err := MustDB().Get(&active, `SELECT COUNT(*) FROM accounts WHERE pot_id = $1 AND active = 1`, pot.ID); err == nil {
+			potActiveAccounts.Set(float64(active), id)
+		}
+	}
+}
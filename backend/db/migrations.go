@@ -44,5 +44,156 @@ var (
 	CREATE TABLE transactions (
 		id				TEXT NOT NULL PRIMARY KEY
 	);`,
+		`
+	INSERT INTO metadata (key, value) VALUES ('sign_commit', '');`,
+		`
+	INSERT INTO metadata (key, value) VALUES ('draw_algorithm', 'align');`,
+		`
+	CREATE TABLE pots (
+		id				INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name			TEXT NOT NULL,
+		account_index	INTEGER NOT NULL,
+		schedule		TEXT NOT NULL DEFAULT 'monthly',
+		entry_id		INTEGER NOT NULL DEFAULT 0,
+		sign_key		TEXT NOT NULL,
+		sign_commit		TEXT NOT NULL DEFAULT '',
+		draw_algorithm	TEXT NOT NULL DEFAULT 'align',
+		active			INTEGER NOT NULL DEFAULT 1
+	);
+	CREATE UNIQUE INDEX idx_pot_account_index ON pots(account_index);
+	INSERT INTO pots (id, name, account_index, schedule, entry_id, sign_key, sign_commit, draw_algorithm)
+		VALUES (1, 'monthly', 0, 'monthly',
+			(SELECT value FROM metadata WHERE key = 'entry_id'),
+			(SELECT value FROM metadata WHERE key = 'sign_key'),
+			(SELECT value FROM metadata WHERE key = 'sign_commit'),
+			(SELECT value FROM metadata WHERE key = 'draw_algorithm'));
+	DELETE FROM metadata WHERE key IN ('entry_id', 'sign_key', 'sign_commit', 'draw_algorithm');
+	ALTER TABLE accounts ADD COLUMN pot_id INTEGER NOT NULL DEFAULT 1;
+	DROP INDEX idx_addr_idx;
+	CREATE UNIQUE INDEX idx_pot_user_name ON accounts(pot_id, user_name);
+	CREATE INDEX idx_pot_addr_idx ON accounts(pot_id, address_index);
+	CREATE TABLE pot_entries (
+		pot_id			INTEGER NOT NULL,
+		id				INTEGER NOT NULL,
+		account_id		INTEGER NOT NULL,
+		hash			TEXT NOT NULL,
+		PRIMARY KEY (pot_id, id)
+	);
+	INSERT INTO pot_entries (pot_id, id, account_id, hash) SELECT 1, id, account_id, hash FROM entries;
+	DROP TABLE entries;
+	ALTER TABLE pot_entries RENAME TO entries;
+	CREATE INDEX idx_acct_id ON entries(account_id);
+	CREATE INDEX idx_hash ON entries(hash);
+	CREATE TABLE pot_winners (
+		pot_id			INTEGER NOT NULL,
+		date			TEXT NOT NULL,
+		info			TEXT NOT NULL,
+		transfer_body 	TEXT,
+		PRIMARY KEY (pot_id, date)
+	);
+	INSERT INTO pot_winners (pot_id, date, info, transfer_body) SELECT 1, date, info, transfer_body FROM winners;
+	DROP TABLE winners;
+	ALTER TABLE pot_winners RENAME TO winners;`,
+		`
+	CREATE TABLE jobs (
+		id				INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		type			TEXT NOT NULL,
+		payload			TEXT NOT NULL DEFAULT '',
+		status			TEXT NOT NULL DEFAULT 'pending',
+		attempts		INTEGER NOT NULL DEFAULT 0,
+		max_attempts	INTEGER NOT NULL DEFAULT 10,
+		next_run		INTEGER NOT NULL,
+		last_error		TEXT,
+		created_at		INTEGER NOT NULL,
+		updated_at		INTEGER NOT NULL
+	);
+	CREATE INDEX idx_job_status_next_run ON jobs(status, next_run);`,
+		`
+	CREATE TABLE payouts (
+		id				INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		pot_id			INTEGER NOT NULL,
+		month			TEXT NOT NULL,
+		destination		TEXT NOT NULL,
+		amount			INTEGER NOT NULL,
+		tx_hash			TEXT,
+		tx_key			TEXT,
+		fee				INTEGER NOT NULL DEFAULT 0,
+		status			TEXT NOT NULL,
+		error			TEXT,
+		attempted_at	INTEGER NOT NULL
+	);
+	CREATE INDEX idx_payout_month ON payouts(pot_id, month);
+	CREATE INDEX idx_payout_destination ON payouts(destination);
+	CREATE INDEX idx_payout_tx_hash ON payouts(tx_hash);`,
+		`
+	ALTER TABLE payouts ADD COLUMN confirmations INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE payouts ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE payouts ADD COLUMN updated_at INTEGER;
+	CREATE INDEX idx_payout_status ON payouts(status);`,
+		`
+	ALTER TABLE winners ADD COLUMN payout_status TEXT NOT NULL DEFAULT '';
+	ALTER TABLE winners ADD COLUMN payout_preview TEXT;`,
+		`
+	CREATE TABLE prices (
+		id				INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		date			TEXT NOT NULL,
+		source			TEXT NOT NULL,
+		xmr_usd			INTEGER NOT NULL DEFAULT 0,
+		entry_price		INTEGER NOT NULL DEFAULT 0,
+		error			TEXT,
+		outlier			INTEGER NOT NULL DEFAULT 0,
+		created_at		INTEGER NOT NULL
+	);
+	CREATE INDEX idx_price_date ON prices(date, source);`,
+		`
+	ALTER TABLE prices RENAME COLUMN xmr_usd TO xmr_rate;
+	ALTER TABLE prices ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';`,
+		`
+	CREATE TABLE entry_prices (
+		id				INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		price			INTEGER NOT NULL,
+		currency		TEXT NOT NULL,
+		valid_from		INTEGER NOT NULL
+	);
+	CREATE INDEX idx_entry_price_valid_from ON entry_prices(valid_from);`,
+		`
+	ALTER TABLE transactions ADD COLUMN pot_id INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN account_id INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN account_index INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN address_index INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN amount INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN timestamp INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN price INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN entries INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN source TEXT NOT NULL DEFAULT '';
+	ALTER TABLE transactions ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX idx_transaction_account ON transactions(account_id);
+	ALTER TABLE entries ADD COLUMN tx_id TEXT NOT NULL DEFAULT '';`,
+		`
+	ALTER TABLE winners ADD COLUMN payout_relayed TEXT NOT NULL DEFAULT '';`,
+		`
+	ALTER TABLE pots ADD COLUMN next_draw_algorithm TEXT NOT NULL DEFAULT '';`,
+		`
+	CREATE TABLE ledger_transactions (
+		id				TEXT NOT NULL,
+		pot_id			INTEGER NOT NULL DEFAULT 0,
+		account_id		INTEGER NOT NULL DEFAULT 0,
+		account_index	INTEGER NOT NULL DEFAULT 0,
+		address_index	INTEGER NOT NULL DEFAULT 0,
+		amount			INTEGER NOT NULL DEFAULT 0,
+		height			INTEGER NOT NULL DEFAULT 0,
+		timestamp		INTEGER NOT NULL DEFAULT 0,
+		price			INTEGER NOT NULL DEFAULT 0,
+		entries			INTEGER NOT NULL DEFAULT 0,
+		source			TEXT NOT NULL DEFAULT '',
+		created_at		INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (id, account_index, address_index)
+	);
+	INSERT INTO ledger_transactions SELECT id, pot_id, account_id, account_index, address_index, amount, height,
+		timestamp, price, entries, source, created_at FROM transactions;
+	DROP TABLE transactions;
+	ALTER TABLE ledger_transactions RENAME TO transactions;
+	CREATE INDEX idx_transaction_account ON transactions(account_id);`,
 	}
 )
@@ -0,0 +1,618 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"moneropot/monerorpc"
+	"moneropot/util"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// Payout is one destination of a draw transfer, a split transfer can span several
+	// transactions so their hashes and keys are kept comma separated in the same order
+	Payout struct {
+		ID            int64   `json:"id" db:"id"`
+		PotID         int64   `json:"pot_id" db:"pot_id"`
+		Month         string  `json:"month" db:"month"`
+		Destination   string  `json:"destination" db:"destination"`
+		Amount        uint64  `json:"amount" db:"amount"`
+		TxHash        *string `json:"tx_hash" db:"tx_hash"`
+		TxKey         *string `json:"tx_key" db:"tx_key"`
+		Fee           uint64  `json:"fee" db:"fee"`
+		Status        string  `json:"status" db:"status"`
+		Error         *string `json:"error,omitempty" db:"error"`
+		AttemptedAt   int64   `json:"attempted_at" db:"attempted_at"`
+		Confirmations uint64  `json:"confirmations" db:"confirmations"`
+		Height        uint64  `json:"height" db:"height"`
+		UpdatedAt     *int64  `json:"updated_at" db:"updated_at"`
+	}
+
+	// PendingPayout is a draw transfer waiting for an admin, either built with do_not_relay
+	// or unsigned by the view-only wallet
+	PendingPayout struct {
+		PotID        int64                   `json:"pot_id"`
+		Date         string                  `json:"date"`
+		Status       string                  `json:"status"`
+		Destinations []monerorpc.Destination `json:"destinations"`
+		TxHashList   []string                `json:"tx_hash_list"`
+		Fee          uint64                  `json:"fee"`
+	}
+)
+
+const (
+	PayoutSent      = "sent"
+	PayoutPending   = "pending"
+	PayoutStuck     = "stuck"
+	PayoutConfirmed = "confirmed"
+	PayoutFailed    = "failed"
+
+	// PayoutTopic is the sse topic for failed and stuck payouts
+	PayoutTopic = "payouts"
+
+	// payoutHeightMargin is how many blocks before the oldest tracked payout checkPayouts looks from
+	payoutHeightMargin = 720
+
+	// payout_status of a winners row, empty until the transfer is built
+	WinnerPayoutPendingApproval = "pending_approval"
+	WinnerPayoutApproved        = "approved"
+	WinnerPayoutUnsigned        = "unsigned"
+	WinnerPayoutSent            = "sent"
+	// sending is set before the transfer is made, a payout found sending or one whose transfer
+	// may have gone out without an answer is left for review and never sent again on its own
+	WinnerPayoutSending = "sending"
+	WinnerPayoutReview  = "review"
+)
+
+var (
+	ErrNoPendingPayout      = fmt.Errorf("no payout pending approval")
+	ErrPayoutPartlyRelayed  = fmt.Errorf("payout partly relayed, approve it again to relay the rest")
+	ErrSignedPayoutMismatch = fmt.Errorf("signed payout needs a tx hash and key for each unsigned tx")
+)
+
+func (p *Payout) Save(ex execer) error {
+	if _, err := ex.Exec(`INSERT INTO payouts (pot_id, month, destination, amount, tx_hash, tx_key, fee, status, error, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		p.PotID, p.Month, p.Destination, p.Amount, p.TxHash, p.TxKey, p.Fee, p.Status, p.Error, p.AttemptedAt); err != nil {
+		return fmt.Errorf("Payout.Save error %v", err)
+	}
+	return nil
+}
+
+// splitPayouts records every destination of a transfer_split, the fee is shared by amount
+func splitPayouts(potID int64, month string, tsr *monerorpc.TransferSplitRequest, resp *monerorpc.TransferSplitResponse) []Payout {
+	var (
+		total uint64
+		fee   uint64
+	)
+	for _, dest := range tsr.Destinations {
+		total += dest.Amount
+	}
+	for _, f := range resp.FeeList {
+		fee += uint64(f)
+	}
+	txHash := strings.Join(resp.TxHashList, ",")
+	txKey := strings.Join(resp.TxKeyList, ",")
+	now := util.UtcNow().Unix()
+	var payouts []Payout
+	for _, dest := range tsr.Destinations {
+		p := Payout{
+			PotID:       potID,
+			Month:       month,
+			Destination: dest.Address,
+			Amount:      dest.Amount,
+			TxHash:      &txHash,
+			TxKey:       &txKey,
+			Status:      PayoutSent,
+			AttemptedAt: now,
+		}
+		if total > 0 {
+			p.Fee = uint64(float64(fee) * float64(dest.Amount) / float64(total))
+		}
+		payouts = append(payouts, p)
+	}
+	return payouts
+}
+
+// transferPayout records a single destination transfer, err is the transfer error
+func transferPayout(potID int64, month string, dest monerorpc.Destination, resp *monerorpc.TransferResponse, err error) Payout {
+	p := Payout{
+		PotID:       potID,
+		Month:       month,
+		Destination: dest.Address,
+		Amount:      dest.Amount,
+		Status:      PayoutSent,
+		AttemptedAt: util.UtcNow().Unix(),
+	}
+	if err != nil {
+		msg := err.Error()
+		p.Status = PayoutFailed
+		p.Error = &msg
+		return p
+	}
+	p.TxHash = &resp.TxHash
+	p.TxKey = &resp.TxKey
+	p.Fee = resp.Fee
+	return p
+}
+
+// GetPayouts returns the payouts sent to an address, newest first
+func GetPayouts(potID int64, address string) ([]Payout, error) {
+	db := MustDB()
+	payouts := []Payout{}
+	if err := db.Select(&payouts, `SELECT * FROM payouts WHERE pot_id = $1 AND destination = $2 ORDER BY id DESC`,
+		potID, address); err != nil {
+		return nil, fmt.Errorf("GetPayouts error %v", err)
+	}
+	return payouts, nil
+}
+
+// checkPayouts follows sent payouts in the wallet until they confirm, payouts that fail
+// or stay unconfirmed too long notify the admin
+func checkPayouts() error {
+	db := MustDB()
+	var payouts []Payout
+	if err := db.Select(&payouts, `SELECT * FROM payouts WHERE status IN ($1, $2, $3) AND tx_hash != ''`,
+		PayoutSent, PayoutPending, PayoutStuck); err != nil {
+		return fmt.Errorf("checkPayouts select error %v", err)
+	}
+	if len(payouts) == 0 {
+		return nil
+	}
+	minHeight, err := payoutsMinHeight(payouts)
+	if err != nil {
+		return fmt.Errorf("checkPayouts height error %v", err)
+	}
+	resp, err := Wallet.GetTransfers(&monerorpc.GetTransfersRequest{
+		Out:            true,
+		Pending:        true,
+		Failed:         true,
+		FilterByHeight: true,
+		MinHeight:      minHeight,
+		AllAccounts:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("checkPayouts transfers error %v", err)
+	}
+	out := make(map[string]monerorpc.Transfer)
+	for _, t := range resp.Out {
+		out[t.Txid] = t
+	}
+	failed := make(map[string]bool)
+	for _, t := range resp.Failed {
+		failed[t.Txid] = true
+	}
+	now := util.UtcNow().Unix()
+	stuckAfter := int64(util.Config.PayoutStuckAfter.Seconds())
+	for _, payout := range payouts {
+		status, confirmations, height := PayoutConfirmed, uint64(0), uint64(0)
+		seen := false
+		// a split payout is only as far along as its slowest transaction
+		for _, txHash := range strings.Split(*payout.TxHash, ",") {
+			t, ok := out[txHash]
+			if failed[txHash] {
+				status = PayoutFailed
+				break
+			} else if !ok {
+				status = PayoutPending
+				continue
+			}
+			if !seen || t.Confirmations < confirmations {
+				confirmations = t.Confirmations
+			}
+			seen = true
+			if t.Height > height {
+				height = t.Height
+			}
+			if t.Confirmations < util.Config.PayoutConfirmations && status == PayoutConfirmed {
+				status = PayoutPending
+			}
+		}
+		if status == PayoutPending && now-payout.AttemptedAt > stuckAfter {
+			status = PayoutStuck
+		}
+		if status == payout.Status && confirmations == payout.Confirmations {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE payouts SET status = $1, confirmations = $2, height = $3, updated_at = $4 WHERE id = $5`,
+			status, confirmations, height, now, payout.ID); err != nil {
+			return fmt.Errorf("checkPayouts update error %v", err)
+		}
+		if status != payout.Status && (status == PayoutFailed || status == PayoutStuck) {
+			notifyPayout(payout, status)
+		}
+	}
+	return nil
+}
+
+// payoutsMinHeight is the height the transfers of the payouts are looked up from, a payout not
+// mined yet is placed by when it was sent at 2 minutes a block less a margin for slow blocks
+func payoutsMinHeight(payouts []Payout) (uint64, error) {
+	wh, err := Wallet.GetHeight()
+	if err != nil {
+		return 0, err
+	}
+	now := util.UtcNow().Unix()
+	min := wh.Height
+	for _, payout := range payouts {
+		h := payout.Height
+		if h == 0 {
+			if blocks := uint64(now-payout.AttemptedAt) / 120; wh.Height > blocks {
+				h = wh.Height - blocks
+			}
+		}
+		if h < min {
+			min = h
+		}
+	}
+	if min <= payoutHeightMargin {
+		return 0, nil
+	}
+	return min - payoutHeightMargin, nil
+}
+
+func notifyPayout(payout Payout, status string) {
+	payoutLog.Info("payout "+status, "payout_id", payout.ID, "pot_id", payout.PotID, "txid", *payout.TxHash)
+	util.SendEvent(fmt.Sprintf("Payout %d %s\nPot: %d %s\nAddress: %s\nAmount: %s\nTx: %s",
+		payout.ID, status, payout.PotID, payout.Month, payout.Destination,
+		monerorpc.XMRToDecimal(payout.Amount), *payout.TxHash))
+	b, err := json.Marshal(map[string]interface{}{
+		"id":      payout.ID,
+		"pot_id":  payout.PotID,
+		"month":   payout.Month,
+		"status":  status,
+		"tx_hash": *payout.TxHash,
+	})
+	if err != nil {
+		payoutLog.Error("notify payout failed", "payout_id", payout.ID, "error", err)
+		return
+	}
+	util.PublishTopic(PayoutTopic, string(b))
+}
+
+// previewTransfer builds the draw transfer without relaying it, an admin approves it before it's sent
+func previewTransfer(db *sqlx.DB, potID int64, date string, tsr *monerorpc.TransferSplitRequest) error {
+	tsr.DoNotRelay = true
+	tsr.GetTxMetadata = true
+	resp, err := Wallet.TransferSplit(tsr)
+	if err != nil {
+		return fmt.Errorf("previewTransfer error %v", err)
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("previewTransfer marshal error %v", err)
+	}
+	if _, err := db.Exec(`UPDATE winners SET payout_status = $1, payout_preview = $2 WHERE pot_id = $3 AND date = $4`,
+		WinnerPayoutPendingApproval, string(b), potID, date); err != nil {
+		return fmt.Errorf("previewTransfer update error %v", err)
+	}
+	lockedEvent(fmt.Sprintf("Payout for pot %d %s is waiting for approval\nTxs: %d\nFee: %s",
+		potID, date, len(resp.TxHashList), monerorpc.XMRToDecimal(totalFee(resp))))
+	return nil
+}
+
+func totalFee(resp *monerorpc.TransferSplitResponse) uint64 {
+	var fee uint64
+	for _, f := range resp.FeeList {
+		fee += uint64(f)
+	}
+	return fee
+}
+
+// pendingTransfer reads the transfer and its preview of a winner waiting for approval
+func pendingTransfer(w *Winner, status string) (*monerorpc.TransferSplitRequest, *monerorpc.TransferSplitResponse, error) {
+	if w.PayoutStatus != status || w.TransferBody == nil || w.PayoutPreview == nil {
+		return nil, nil, ErrNoPendingPayout
+	}
+	tsr := &monerorpc.TransferSplitRequest{}
+	if err := json.Unmarshal([]byte(*w.TransferBody), tsr); err != nil {
+		return nil, nil, fmt.Errorf("pendingTransfer unmarshal error %v", err)
+	}
+	resp := &monerorpc.TransferSplitResponse{}
+	if err := json.Unmarshal([]byte(*w.PayoutPreview), resp); err != nil {
+		return nil, nil, fmt.Errorf("pendingTransfer unmarshal preview error %v", err)
+	}
+	return tsr, resp, nil
+}
+
+func GetPendingPayouts() ([]PendingPayout, error) {
+	db := MustDB()
+	var winners []Winner
+	if err := db.Select(&winners, `SELECT * FROM winners WHERE payout_status IN ($1, $2) ORDER BY date`,
+		WinnerPayoutPendingApproval, WinnerPayoutUnsigned); err != nil {
+		return nil, fmt.Errorf("GetPendingPayouts error %v", err)
+	}
+	pending := []PendingPayout{}
+	for i := range winners {
+		tsr, resp, err := pendingTransfer(&winners[i], winners[i].PayoutStatus)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, PendingPayout{
+			PotID:        winners[i].PotID,
+			Date:         winners[i].Date,
+			Status:       winners[i].PayoutStatus,
+			Destinations: tsr.Destinations,
+			TxHashList:   resp.TxHashList,
+			Fee:          totalFee(resp),
+		})
+	}
+	return pending, nil
+}
+
+// ApprovePayout relays the previewed transfer of a draw, the txs relayed are kept as it goes so a
+// relay that fails part way leaves the draw pending and approving it again relays only the rest
+func ApprovePayout(potID int64, date string) error {
+	db := MustDB()
+	dbLock.Lock()
+	defer unlockDB()
+
+	w := &Winner{}
+	if err := db.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, potID, date); err != nil {
+		if util.NoRows(err) {
+			return ErrNoPendingPayout
+		}
+		return fmt.Errorf("ApprovePayout select error %v", err)
+	}
+	tsr, resp, err := pendingTransfer(w, WinnerPayoutPendingApproval)
+	if err != nil {
+		return err
+	}
+	if len(resp.TxHashList) != len(resp.TxMetadataList) {
+		return fmt.Errorf("ApprovePayout preview has %d hashes for %d txs", len(resp.TxHashList), len(resp.TxMetadataList))
+	}
+	var relayed []string
+	done := make(map[string]bool)
+	if w.PayoutRelayed != "" {
+		relayed = strings.Split(w.PayoutRelayed, ",")
+		for _, hash := range relayed {
+			done[hash] = true
+		}
+	}
+	for i, metadata := range resp.TxMetadataList {
+		hash := resp.TxHashList[i]
+		if done[hash] {
+			continue
+		}
+		_, err := Wallet.RelayTx(&monerorpc.RelayTxRequest{Hex: metadata})
+		if err != nil {
+			if monerorpc.IsOutcomeUnknown(err) {
+				flagPayoutReview(db, potID, date, fmt.Errorf("relay %d/%d %v", i+1, len(resp.TxMetadataList), err))
+				return fmt.Errorf("ApprovePayout relay error %v, left for review", err)
+			}
+			lockedEvent(fmt.Sprintf("ApprovePayout pot %d %s relay %d/%d error %v",
+				potID, date, i+1, len(resp.TxMetadataList), err))
+			return fmt.Errorf("ApprovePayout relay error %v", err)
+		}
+		relayed = append(relayed, hash)
+		if _, err := db.Exec(`UPDATE winners SET payout_relayed = $1 WHERE pot_id = $2 AND date = $3`,
+			strings.Join(relayed, ","), potID, date); err != nil {
+			// approving again would relay it twice
+			flagPayoutReview(db, potID, date, fmt.Errorf("relayed %s but failed to keep it: %v", hash, err))
+			return fmt.Errorf("ApprovePayout update relayed error %v, left for review", err)
+		}
+	}
+	if err := clearTransferBody(db, potID, date, WinnerPayoutApproved, splitPayouts(potID, date, tsr, resp)); err != nil {
+		lockedEvent("ApprovePayout failed to null transfer_body: " + err.Error())
+		return fmt.Errorf("ApprovePayout error %v", err)
+	}
+	payoutLog.Info("approved payout relayed", "pot_id", potID, "month", date, "txid", strings.Join(resp.TxHashList, ","))
+	return nil
+}
+
+// flagPayoutReview stops the payout until an admin checked the wallet, sending it again could pay twice
+func flagPayoutReview(db *sqlx.DB, potID int64, date string, reason error) error {
+	if _, err := db.Exec(`UPDATE winners SET payout_status = $1 WHERE pot_id = $2 AND date = $3`,
+		WinnerPayoutReview, potID, date); err != nil {
+		return fmt.Errorf("flagPayoutReview error %v", err)
+	}
+	payoutLog.Error("payout needs review", "pot_id", potID, "month", date, "error", reason)
+	lockedEvent(fmt.Sprintf("Payout for pot %d %s needs review, check the wallet before resolving it: %v",
+		potID, date, reason))
+	return nil
+}
+
+// ResolvePayout closes a payout left for review, sent when the wallet shows the transfer went out
+// otherwise it's queued to be sent again
+func ResolvePayout(potID int64, date string, sent bool) error {
+	db := MustDB()
+	dbLock.Lock()
+	defer unlockDB()
+
+	w := &Winner{}
+	if err := db.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, potID, date); err != nil {
+		if util.NoRows(err) {
+			return ErrNoPendingPayout
+		}
+		return fmt.Errorf("ResolvePayout select error %v", err)
+	}
+	if w.PayoutStatus != WinnerPayoutReview || w.TransferBody == nil {
+		return ErrNoPendingPayout
+	}
+	if w.PayoutPreview != nil {
+		// an approved preview goes back to approval, approving it again relays what's left,
+		// a signed one back to be signed and submitted again
+		tsr, resp, err := pendingTransfer(w, WinnerPayoutReview)
+		if err != nil {
+			return err
+		}
+		sentStatus, pendingStatus := WinnerPayoutApproved, WinnerPayoutPendingApproval
+		if resp.UnsignedTxset != "" {
+			sentStatus, pendingStatus = WinnerPayoutSent, WinnerPayoutUnsigned
+		}
+		if sent {
+			if err := clearTransferBody(db, potID, date, sentStatus, splitPayouts(potID, date, tsr, resp)); err != nil {
+				return fmt.Errorf("ResolvePayout error %v", err)
+			}
+			payoutLog.Info("reviewed payout relayed", "pot_id", potID, "month", date)
+			return nil
+		}
+		if _, err := db.Exec(`UPDATE winners SET payout_status = $1 WHERE pot_id = $2 AND date = $3`,
+			pendingStatus, potID, date); err != nil {
+			return fmt.Errorf("ResolvePayout error %v", err)
+		}
+		payoutLog.Info("reviewed payout pending "+pendingStatus, "pot_id", potID, "month", date)
+		return nil
+	}
+	if sent {
+		if err := clearTransferBody(db, potID, date, WinnerPayoutSent, nil); err != nil {
+			return fmt.Errorf("ResolvePayout error %v", err)
+		}
+		payoutLog.Info("reviewed payout sent", "pot_id", potID, "month", date)
+		return nil
+	}
+	if _, err := db.Exec(`UPDATE winners SET payout_status = '' WHERE pot_id = $1 AND date = $2`, potID, date); err != nil {
+		return fmt.Errorf("ResolvePayout error %v", err)
+	}
+	payoutLog.Info("reviewed payout queued again", "pot_id", potID, "month", date)
+	return enqueueJob(db, JobPayout, payoutPayload{PotID: potID, Date: date})
+}
+
+// DiscardPayout drops a previewed transfer and queues building a new one,
+// for when the preview went stale or its fee is too high
+func DiscardPayout(potID int64, date string) error {
+	db := MustDB()
+	var relayed string
+	if err := db.Get(&relayed, `SELECT payout_relayed FROM winners WHERE pot_id = $1 AND date = $2`, potID, date); err != nil {
+		if util.NoRows(err) {
+			return ErrNoPendingPayout
+		}
+		return fmt.Errorf("DiscardPayout error %v", err)
+	}
+	if relayed != "" {
+		// a new transfer would pay the destinations of the relayed txs again
+		return ErrPayoutPartlyRelayed
+	}
+	r, err := db.Exec(`UPDATE winners SET payout_status = '', payout_preview = NULL
+		WHERE pot_id = $1 AND date = $2 AND payout_status IN ($3, $4)`,
+		potID, date, WinnerPayoutPendingApproval, WinnerPayoutUnsigned)
+	if err != nil {
+		return fmt.Errorf("DiscardPayout error %v", err)
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return ErrNoPendingPayout
+	}
+	return enqueueJob(db, JobPayout, payoutPayload{PotID: potID, Date: date})
+}
+
+// unsignedTransfer keeps the unsigned_txset the view-only wallet makes for the draw transfer,
+// it's signed offline and uploaded back with SubmitSignedPayout
+func unsignedTransfer(db *sqlx.DB, potID int64, date string, tsr *monerorpc.TransferSplitRequest) error {
+	resp, err := Wallet.TransferSplit(tsr)
+	if err != nil {
+		return fmt.Errorf("unsignedTransfer error %v", err)
+	}
+	if resp.UnsignedTxset == "" {
+		return fmt.Errorf("unsignedTransfer no unsigned_txset, is the wallet view-only?")
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("unsignedTransfer marshal error %v", err)
+	}
+	if _, err := db.Exec(`UPDATE winners SET payout_status = $1, payout_preview = $2 WHERE pot_id = $3 AND date = $4`,
+		WinnerPayoutUnsigned, string(b), potID, date); err != nil {
+		return fmt.Errorf("unsignedTransfer update error %v", err)
+	}
+	lockedEvent(fmt.Sprintf("Payout for pot %d %s is waiting to be signed offline\nFee: %s",
+		potID, date, monerorpc.XMRToDecimal(totalFee(resp))))
+	return nil
+}
+
+// GetUnsignedTxset returns the unsigned_txset of a draw to sign offline
+func GetUnsignedTxset(potID int64, date string) (string, error) {
+	db := MustDB()
+	w := &Winner{}
+	if err := db.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, potID, date); err != nil {
+		if util.NoRows(err) {
+			return "", ErrNoPendingPayout
+		}
+		return "", fmt.Errorf("GetUnsignedTxset error %v", err)
+	}
+	_, resp, err := pendingTransfer(w, WinnerPayoutUnsigned)
+	if err != nil {
+		return "", err
+	}
+	return resp.UnsignedTxset, nil
+}
+
+// SubmitSignedPayout relays the offline signed txset of a draw, the tx hashes and keys come from
+// the signing wallet since the view-only wallet can't make them. The wallet can't read a signed
+// txset so its txs are checked with their keys once relayed, a payout that doesn't match the
+// transfer is left for review
+func SubmitSignedPayout(potID int64, date string, signed *monerorpc.SignTransferResponse) error {
+	db := MustDB()
+	dbLock.Lock()
+	defer unlockDB()
+
+	w := &Winner{}
+	if err := db.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, potID, date); err != nil {
+		if util.NoRows(err) {
+			return ErrNoPendingPayout
+		}
+		return fmt.Errorf("SubmitSignedPayout select error %v", err)
+	}
+	tsr, resp, err := pendingTransfer(w, WinnerPayoutUnsigned)
+	if err != nil {
+		return err
+	}
+	if len(signed.TxHashList) == 0 || len(signed.TxHashList) != len(resp.FeeList) || len(signed.TxKeyList) != len(signed.TxHashList) {
+		return ErrSignedPayoutMismatch
+	}
+	// a payout left for review records the signed txs when it's resolved sent
+	resp.TxHashList = signed.TxHashList
+	resp.TxKeyList = signed.TxKeyList
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("SubmitSignedPayout marshal error %v", err)
+	}
+	if _, err := db.Exec(`UPDATE winners SET payout_preview = $1 WHERE pot_id = $2 AND date = $3`, string(b), potID, date); err != nil {
+		return fmt.Errorf("SubmitSignedPayout update error %v", err)
+	}
+	submitted, err := Wallet.SubmitTransfer(&monerorpc.SubmitTransferRequest{TxDataHex: signed.SignedTxset})
+	if err != nil {
+		if monerorpc.IsOutcomeUnknown(err) {
+			flagPayoutReview(db, potID, date, err)
+			return fmt.Errorf("SubmitSignedPayout submit error %v, left for review", err)
+		}
+		return fmt.Errorf("SubmitSignedPayout submit error %v", err)
+	}
+	if err := checkSignedPayout(tsr, signed, submitted); err != nil {
+		flagPayoutReview(db, potID, date, err)
+		return fmt.Errorf("SubmitSignedPayout %v, left for review", err)
+	}
+	if err := clearTransferBody(db, potID, date, WinnerPayoutSent, splitPayouts(potID, date, tsr, resp)); err != nil {
+		lockedEvent("SubmitSignedPayout failed to null transfer_body: " + err.Error())
+		return fmt.Errorf("SubmitSignedPayout error %v", err)
+	}
+	payoutLog.Info("signed payout relayed", "pot_id", potID, "month", date, "txid", strings.Join(submitted.TxHashList, ","))
+	return nil
+}
+
+// checkSignedPayout makes sure the wallet relayed the signed txs and that they pay each
+// destination of the transfer its amount
+func checkSignedPayout(tsr *monerorpc.TransferSplitRequest, signed *monerorpc.SignTransferResponse, submitted *monerorpc.SubmitTransferResponse) error {
+	if strings.Join(submitted.TxHashList, ",") != strings.Join(signed.TxHashList, ",") {
+		return fmt.Errorf("relayed txs %v are not the signed %v", submitted.TxHashList, signed.TxHashList)
+	}
+	amounts := make(map[string]uint64)
+	for _, dest := range tsr.Destinations {
+		amounts[dest.Address] += dest.Amount
+	}
+	for address, amount := range amounts {
+		var received uint64
+		for i, hash := range signed.TxHashList {
+			resp, err := Wallet.CheckTxKey(&monerorpc.CheckTxKeyRequest{Txid: hash, TxKey: signed.TxKeyList[i], Address: address})
+			if err != nil {
+				return fmt.Errorf("check tx key %s error %v", hash, err)
+			}
+			received += resp.Received
+		}
+		if received != amount {
+			return fmt.Errorf("%s received %d not %d", address, received, amount)
+		}
+	}
+	return nil
+}
@@ -1,29 +1,48 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"moneropot/monerorpc"
 	"moneropot/util"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 type (
+	// WinnerInfo is the published draw, Amount and Accounts repeat the first of Tiers
 	WinnerInfo struct {
-		Date     string           `json:"date,omitempty"`
-		SignKey  string           `json:"sign_key"`
-		Block    string           `json:"block"`
-		Entries  int64            `json:"entries"`
+		Date       string           `json:"date,omitempty"`
+		SignKey    string           `json:"sign_key"`
+		Commitment string           `json:"commitment,omitempty"`
+		Algorithm  string           `json:"algorithm,omitempty"`
+		Block      string           `json:"block"`
+		Entries    int64            `json:"entries"`
+		Amount     int64            `json:"amount"`
+		Accounts   map[string][]int `json:"accounts"`
+		Tiers      []WinnerTier     `json:"tiers,omitempty"`
+		Split      *util.Split      `json:"split,omitempty"`
+	}
+
+	WinnerTier struct {
+		Score    int              `json:"score"`
 		Amount   int64            `json:"amount"`
 		Accounts map[string][]int `json:"accounts"`
 	}
 
+	DrawTier struct {
+		Score   int
+		Entries []int
+	}
+
 	WinAccount struct {
 		ID          int64   `db:"id"`
 		UserName    *string `db:"user_name"`
@@ -33,125 +52,64 @@ type (
 	}
 )
 
-var (
-	errAlreadyProcessed = fmt.Errorf("already processed")
-)
-
-func runPickWinner() {
-	if err := pickWinner(); err != nil {
-		log.Println("runPickWinner error ", err)
-		time.AfterFunc(time.Minute*1, runPickWinner)
-		return
+func runPickWinner(potID int64, at time.Time) error {
+	pot, err := GetPot(potID)
+	if err != nil {
+		return err
 	}
-	pickWinnerTimer = time.AfterFunc(StartOfMonth(), runPickWinner)
+	return pickWinner(pot, at)
 }
 
-func FlushWinPayload(month string) error {
+func FlushWinPayload(potID int64, month string) error {
 	db := MustDB()
-	_, err := db.Exec(`UPDATE winners SET transfer_body = NULL WHERE date = $1`, month)
+	_, err := db.Exec(`UPDATE winners SET transfer_body = NULL WHERE pot_id = $1 AND date = $2`, potID, month)
 	return err
 }
 
-func pickWinner() error {
+func pickWinner(pot *Pot, at time.Time) error {
 	// make sure there's no missed transfers from last check before running the pick winner
 	if err := CheckMissedTransfers(); err != nil {
 		return fmt.Errorf("pickWinner missed transfer error %v", err)
 	}
-	now := util.UtcNow()
-	year, month, _ := now.Date()
-	prevMonth := time.Date(year, month-1, 1, 0, 0, 0, 0, now.Location())
-	winMonth := prevMonth.Format("2006-01")
-	log.Println("Picking winner for", winMonth)
+	// reload for the latest entries
+	pot, err := GetPot(pot.ID)
+	if err != nil {
+		return fmt.Errorf("pickWinner pot error %v", err)
+	}
+	winMonth, periodStart := pot.drawPeriod(at)
+	dlog := drawLog.With("pot_id", pot.ID, "month", winMonth)
+	dlog.Info("picking winner")
 	db := MustDB()
 	dbLock.Lock()
-	defer dbLock.Unlock()
+	defer unlockDB()
 
-	// first make sure this month hasn't already been processed and if it's already been distributed
-	checkAndTransfer := func() error {
-		w := &Winner{}
-		err := db.Get(w, `SELECT * FROM winners WHERE date = $1`, winMonth)
-		if err != nil {
-			if util.NoRows(err) {
-				return nil
-			}
-			return fmt.Errorf("checkAndTransfer select error %v", err)
-		}
+	// first make sure this period hasn't already been drawn
+	w := &Winner{}
+	if err := db.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, pot.ID, winMonth); err == nil {
 		if w.TransferBody != nil {
-			// store transfer request to filesystem and remove in db
-			reqPath := filepath.Join(util.Config.DataPath, "transfers")
-			if err := os.MkdirAll(reqPath, 0755); err != nil {
-				return fmt.Errorf("checkAndTransfers mkdir error %v", err)
+			// drawn but not paid yet, the payout job retries the transfer
+			if err := enqueueJob(db, JobPayout, payoutPayload{PotID: pot.ID, Date: winMonth}); err != nil {
+				return fmt.Errorf("pickWinner payout job error %v", err)
 			}
-			reqPath = filepath.Join(reqPath, winMonth+".json")
-			b := []byte(*w.TransferBody)
-			if err := ioutil.WriteFile(reqPath, b, 0644); err != nil {
-				return fmt.Errorf("checkAndTransfers writefile error %v", err)
-			}
-			tsr := &monerorpc.TransferSplitRequest{}
-			if err := json.Unmarshal(b, tsr); err != nil {
-				return fmt.Errorf("checkAndTransfers unmarshal error %v", err)
-			}
-			// make sure we don't have a locked amount
-			_, err := GetDistributedAmounts(true)
-			if err != nil {
-				return fmt.Errorf("checkAndTransfers distribute amount has error %v", err)
-			}
-			walletLock.Lock()
-			_, err = Wallet.TransferSplit(tsr)
-			walletLock.Unlock()
-			var randomOutsErr bool
-			if err != nil {
-				randomOutsErr = strings.Contains(err.Error(), "failed to get random outs")
-				if !randomOutsErr {
-					util.SendEvent("checkAndTransfers transfer error " + err.Error() + "\nPayload: \n" + *w.TransferBody)
-					return fmt.Errorf("checkAndTransfers transfer error %v", err)
-				}
-			}
-			if _, err := db.Exec(`UPDATE winners SET transfer_body = NULL WHERE date = $1`, winMonth); err != nil {
-				log.Println("checkAndTransfers failed to null transfer_body", err)
-				util.SendEvent("checkAndTransfers failed to null transfer_body: " + err.Error())
-			} else if randomOutsErr {
-				// try to send this 1 at a time, and not retry anymore
-				// todo if it still fails we can do a sweep to itself?
-				var failedTransfers []string
-				walletLock.Lock()
-				for _, v := range tsr.Destinations {
-					_, err = Wallet.Transfer(&monerorpc.TransferRequest{
-						Destinations: []monerorpc.Destination{
-							{Amount: v.Amount, Address: v.Address},
-						},
-					})
-					if err != nil {
-						failedTransfers = append(failedTransfers,
-							fmt.Sprintf("Address: %s \nAmount: %s \nXMR: %d \nError %s",
-								v.Address, monerorpc.XMRToDecimal(v.Amount), v.Amount, err.Error()))
-					}
-				}
-				walletLock.Unlock()
-				if len(failedTransfers) > 0 {
-					util.SendEvent("checkAndTransfers transfer failed --\n" + strings.Join(failedTransfers, "\n-----\n"))
-				}
-			}
-		} else {
-			return errAlreadyProcessed
-		}
-		return nil
-	}
-	if err := checkAndTransfer(); err != nil {
-		if err == errAlreadyProcessed {
-			log.Println("pick winner ran already processed", winMonth)
-			util.SendEvent("pick winner ran already processed " + winMonth)
 			return nil
 		}
-		return fmt.Errorf("pickWinner error %v", err)
+		dlog.Warn("already drawn")
+		lockedEvent("pick winner ran already processed " + winMonth)
+		return nil
+	} else if !util.NoRows(err) {
+		return fmt.Errorf("pickWinner select winner error %v", err)
 	}
 
-	firstBlock, err := GetFirstBlockOfMonth(util.UtcNow())
+	firstBlock, err := GetFirstBlockAfter(periodStart)
 	if err != nil {
 		return fmt.Errorf("pickWinner first block error %v", err)
 	}
+	if err := confirmFirstBlock(periodStart, firstBlock); err != nil {
+		return fmt.Errorf("pickWinner first block error %v", err)
+	}
 
-	amt, err := GetDistributedAmounts(false)
+	split := util.Config.Split
+	amt, err := GetDistributedAmounts(context.Background(), pot, false)
 	if err != nil {
 		return fmt.Errorf("pickWinner get distrubuted amount error %v", err)
 	}
@@ -163,88 +121,92 @@ func pickWinner() error {
 	ra := []refAmounts{}
 	err = db.Select(&ra, `SELECT ref_id, SUM(entries) as total
 	FROM accounts
-	WHERE active = 1 AND entries > 0
-	GROUP BY ref_id`)
+	WHERE pot_id = $1 AND active = 1 AND entries > 0
+	GROUP BY ref_id`, pot.ID)
 	if err != nil {
 		return fmt.Errorf("pickWinner select group error %v", err)
 	}
-	accounts := []Account{}
-	err = db.Select(&accounts, `SELECT * FROM accounts WHERE active = 1 AND entries > 0 AND user_address IS NOT NULL`)
-	if err != nil {
-		return fmt.Errorf("pickWinner select error %v", err)
-	}
 
-	type mData struct {
-		Key   string `db:"key"`
-		Value string `db:"value"`
+	signKey := pot.SignKey
+	signCommit := pot.SignCommit
+	algorithm := pot.DrawAlgorithm
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
 	}
-	var (
-		md    []mData
-		mdMap = make(map[string]string)
-	)
-	err = db.Select(&md, `SELECT * FROM metadata WHERE key IN ('entry_id','sign_key')`)
+	selector, err := GetWinnerSelector(algorithm)
 	if err != nil {
-		return fmt.Errorf("pickWinner metadata select error %v", err)
+		return fmt.Errorf("pickWinner selector error %v", err)
 	}
-	for _, v := range md {
-		mdMap[v.Key] = v.Value
-	}
-	entries := mdMap["entry_id"]
-	signKey := mdMap["sign_key"]
 
-	if entries == "0" {
-		log.Println("pickWinner skipped, no entries for month", winMonth)
-		util.SendEvent("pickWinner skipped, no entries for month " + winMonth)
+	if pot.EntryID == 0 {
+		dlog.Info("skipped without entries")
+		lockedEvent(fmt.Sprintf("pickWinner skipped, no entries for pot %d %s", pot.ID, winMonth))
 		return nil
 	}
-	totalEntries, _ := strconv.Atoi(entries)
-	var (
-		winners []string
-		highest int
-	)
-	log.Println("Processing", totalEntries, "entries")
-	for i := 1; i <= totalEntries; i++ {
-		h := util.HashMatchAlign(firstBlock, util.SignEntry(int64(i), signKey))
-		if h > highest {
-			highest = h
-			winners = make([]string, 0)
+	totalEntries := int(pot.EntryID)
+	dlog.Info("drawing entries", "entries", totalEntries, "block", firstBlock)
+	if len(amt.Tiers) == 0 {
+		return fmt.Errorf("pickWinner no prize tiers")
+	}
+	// each tier goes to the next best score, tiers without entries stay in the pot
+	drawTiers := DrawTiers(selector, firstBlock, signKey, totalEntries, len(amt.Tiers))
+	if len(drawTiers) == 0 {
+		return fmt.Errorf("pickWinner no winning entries out of %d", totalEntries)
+	}
+	destinations := make(map[string]uint64)
+	var winTiers []WinnerTier
+	for i, tier := range drawTiers {
+		var winners []string
+		for _, id := range tier.Entries {
+			winners = append(winners, strconv.Itoa(id))
 		}
-		if h >= highest {
-			winners = append(winners, strconv.Itoa(i))
+		var winAccounts []WinAccount
+		if err := db.Select(&winAccounts, fmt.Sprintf(`
+		SELECT a.id, a.user_address, a.user_name, COUNT(e.id) as wins
+		FROM entries AS e
+		LEFT JOIN accounts as a ON a.id = e.account_id
+		WHERE e.pot_id = %d AND e.id IN (%s)
+		GROUP BY a.id`, pot.ID, strings.Join(winners, ","))); err != nil {
+			return fmt.Errorf("pickWinner win accounts error %v", err)
 		}
-	}
-	var winAccounts []WinAccount
-	if err := db.Select(&winAccounts, fmt.Sprintf(`
-	SELECT a.id, a.user_address, a.user_name, COUNT(e.id) as wins
-	FROM entries AS e
-	LEFT JOIN accounts as a ON a.id = e.account_id
-	WHERE e.id IN (%s)
-	GROUP BY a.id`, strings.Join(winners, ","))); err != nil {
-		return fmt.Errorf("pickWinner win accounts error %v", err)
-	}
-	totalWinners := float64(len(winners))
-	var accountEntries []WinAccount
-	if err := db.Select(&accountEntries, fmt.Sprintf(`
-	SELECT a.user_address, a.user_name, e.id as entry_id
-	FROM entries AS e
-	LEFT JOIN accounts as a ON a.id = e.account_id
-	WHERE e.id IN (%s)`, strings.Join(winners, ","))); err != nil {
-		return fmt.Errorf("pickWinner win account map error %v", err)
-	}
-	winMap := make(map[string][]int)
-	for _, entry := range accountEntries {
-		key := entry.UserAddress
-		if _, ok := winMap[key]; !ok {
-			winMap[key] = make([]int, 0)
+		totalWinners := float64(len(winners))
+		var accountEntries []WinAccount
+		if err := db.Select(&accountEntries, fmt.Sprintf(`
+		SELECT a.user_address, a.user_name, e.id as entry_id
+		FROM entries AS e
+		LEFT JOIN accounts as a ON a.id = e.account_id
+		WHERE e.pot_id = %d AND e.id IN (%s)`, pot.ID, strings.Join(winners, ","))); err != nil {
+			return fmt.Errorf("pickWinner win account map error %v", err)
+		}
+		winMap := make(map[string][]int)
+		for _, entry := range accountEntries {
+			key := entry.UserAddress
+			if _, ok := winMap[key]; !ok {
+				winMap[key] = make([]int, 0)
+			}
+			winMap[key] = append(winMap[key], int(entry.EntryID))
 		}
-		winMap[key] = append(winMap[key], int(entry.EntryID))
+		winAmount := float64(amt.Tiers[i])
+		for _, winAccount := range winAccounts {
+			val, ok := destinations[winAccount.UserAddress]
+			if !ok {
+				destinations[winAccount.UserAddress] = 0
+			}
+			destinations[winAccount.UserAddress] = val + uint64(winAmount*(float64(winAccount.Wins)/totalWinners))
+		}
+		winTiers = append(winTiers, WinnerTier{
+			Score:    tier.Score,
+			Amount:   int64(amt.Tiers[i]),
+			Accounts: winMap,
+		})
 	}
 
 	// calculate refs for distribution
 	tr := &monerorpc.TransferSplitRequest{
-		Priority:   0,
-		Mixin:      8,
-		UnlockTime: 10,
+		AccountIndex: pot.AccountIndex,
+		Priority:     0,
+		Mixin:        8,
+		UnlockTime:   10,
 	}
 	tr.Destinations = append(tr.Destinations, monerorpc.Destination{
 		Amount:  amt.Maintenance,
@@ -254,15 +216,6 @@ func pickWinner() error {
 		Amount:  amt.Fund,
 		Address: util.Config.FundAddress,
 	})
-	winAmount := float64(amt.Winner)
-	destinations := make(map[string]uint64)
-	for _, winAccount := range winAccounts {
-		val, ok := destinations[winAccount.UserAddress]
-		if !ok {
-			destinations[winAccount.UserAddress] = 0
-		}
-		destinations[winAccount.UserAddress] = val + uint64(winAmount*(float64(winAccount.Wins)/totalWinners))
-	}
 	refAmt := float64(amt.Referrals)
 	var refIDs []string
 	refMap := make(map[int64]uint64)
@@ -299,11 +252,24 @@ func pickWinner() error {
 			Address: addr,
 		})
 	}
+	// a 0% share has nothing to send and the wallet refuses zero amounts
+	paid := tr.Destinations[:0]
+	for _, d := range tr.Destinations {
+		if d.Amount > 0 {
+			paid = append(paid, d)
+		}
+	}
+	tr.Destinations = paid
 
 	b, err := json.Marshal(tr)
 	if err != nil {
 		return fmt.Errorf("pickWinner marshall error %v", err)
 	}
+	// secret key for the next round, only its commitment is public until the next draw
+	nextSeed, err := util.NewSeed()
+	if err != nil {
+		return fmt.Errorf("pickWinner next seed error %v", err)
+	}
 	// transaction here, must complete or fail all and restart the process
 	tx, err := db.Begin()
 	if err != nil {
@@ -312,18 +278,23 @@ func pickWinner() error {
 
 	// insert the winner
 	winInfo := WinnerInfo{
-		SignKey:  signKey,
-		Block:    firstBlock,
-		Entries:  int64(totalEntries),
-		Amount:   int64(amt.Winner),
-		Accounts: winMap,
+		SignKey:    signKey,
+		Commitment: signCommit,
+		Algorithm:  algorithm,
+		Block:      firstBlock,
+		Entries:    int64(totalEntries),
+		Amount:     winTiers[0].Amount,
+		Accounts:   winTiers[0].Accounts,
+		Tiers:      winTiers,
+		Split:      &split,
 	}
 	bw, err := json.Marshal(winInfo)
 	if err != nil {
 		return fmt.Errorf("pickWinner marshal info error %v", err)
 	}
-	_, err = tx.Exec(`INSERT INTO winners (date, info, transfer_body)
-		VALUES ($1, $2, $3)`,
+	_, err = tx.Exec(`INSERT INTO winners (pot_id, date, info, transfer_body)
+		VALUES ($1, $2, $3, $4)`,
+		pot.ID,
 		winMonth,
 		string(bw),
 		string(b),
@@ -349,33 +320,201 @@ func pickWinner() error {
 		amount = 0,
 		entries = 0,
 		ref_id = 0
-		WHERE user_name IS NULL OR
-			(entries = 0 AND id NOT IN (%s));
-		UPDATE accounts SET entries = 0 WHERE entries > 0;
-		UPDATE metadata SET value = '0' WHERE key = 'entry_id';
-		UPDATE metadata SET value = '%s' WHERE key = 'sign_key';
-		DELETE FROM entries;`, refs, firstBlock))
+		WHERE pot_id = %[1]d AND (user_name IS NULL OR
+			(entries = 0 AND id NOT IN (%[2]s)));
+		UPDATE accounts SET entries = 0 WHERE pot_id = %[1]d AND entries > 0;
+		UPDATE pots SET entry_id = 0, sign_key = '%[3]s', sign_commit = '%[4]s',
+			draw_algorithm = CASE WHEN next_draw_algorithm != '' THEN next_draw_algorithm ELSE draw_algorithm END,
+			next_draw_algorithm = '' WHERE id = %[1]d;
+		DELETE FROM entries WHERE pot_id = %[1]d;`, pot.ID, refs, nextSeed, util.Commitment(nextSeed)))
 	if err != nil {
 		return fmt.Errorf("pickWinner tx update error %v -> Rollback: %v", err, tx.Rollback())
 	}
 
+	if err := enqueueJob(tx, JobPayout, payoutPayload{PotID: pot.ID, Date: winMonth}); err != nil {
+		return fmt.Errorf("pickWinner tx payout job error %v -> Rollback: %v", err, tx.Rollback())
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("pickWinner tx commit error %v -> Rollback: %v", err, tx.Rollback())
 	}
 
-	if err := checkAndTransfer(); err != nil {
-		return fmt.Errorf("pickWinner checkAndTransfer error %v", err)
-	}
+	refreshInfo(pot.ID)
+	lockedEvent(fmt.Sprintf("pickWinner pot %d new round commitment %s", pot.ID, util.Commitment(nextSeed)))
+
+	dlog.Info("winner picked")
+	return nil
+}
+
+// transferWinner relays the payout of a draw, the transfer body is cleared once sent
+func transferWinner(pot *Pot, date string) error {
+	db := MustDB()
+	dbLock.Lock()
+	defer unlockDB()
 
-	log.Println("pickWinner completed")
+	w := &Winner{}
+	if err := db.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, pot.ID, date); err != nil {
+		return fmt.Errorf("transferWinner select error %v", err)
+	}
+	if w.TransferBody == nil {
+		payoutLog.Info("already paid", "pot_id", pot.ID, "month", date)
+		return nil
+	}
+	if w.PayoutStatus == WinnerPayoutPendingApproval || w.PayoutStatus == WinnerPayoutUnsigned || w.PayoutStatus == WinnerPayoutReview {
+		payoutLog.Info("waiting for "+w.PayoutStatus, "pot_id", pot.ID, "month", date)
+		return nil
+	}
+	if w.PayoutStatus == WinnerPayoutSending {
+		// an earlier attempt stopped after claiming the transfer, it may have gone out
+		return flagPayoutReview(db, pot.ID, date, fmt.Errorf("payout was left sending"))
+	}
+	// store transfer request to filesystem and remove in db
+	reqPath := filepath.Join(util.Config.DataPath, "transfers")
+	if err := os.MkdirAll(reqPath, 0755); err != nil {
+		return fmt.Errorf("transferWinner mkdir error %v", err)
+	}
+	reqPath = filepath.Join(reqPath, transferFileName(pot.ID, date))
+	b := []byte(*w.TransferBody)
+	if err := ioutil.WriteFile(reqPath, b, 0644); err != nil {
+		return fmt.Errorf("transferWinner writefile error %v", err)
+	}
+	tsr := &monerorpc.TransferSplitRequest{}
+	if err := json.Unmarshal(b, tsr); err != nil {
+		return fmt.Errorf("transferWinner unmarshal error %v", err)
+	}
+	// make sure we don't have a locked amount
+	if _, err := GetDistributedAmounts(context.Background(), pot, true); err != nil {
+		return fmt.Errorf("transferWinner distribute amount has error %v", err)
+	}
+	tsr.GetTxKeys = true
+	if util.Config.ViewOnly {
+		return unsignedTransfer(db, pot.ID, date, tsr)
+	}
+	if util.Config.PayoutApproval {
+		return previewTransfer(db, pot.ID, date, tsr)
+	}
+	// claim the transfer first, a job finding it sending can't tell if it was sent
+	r, err := db.Exec(`UPDATE winners SET payout_status = $1 WHERE pot_id = $2 AND date = $3
+		AND transfer_body IS NOT NULL AND payout_status = $4`, WinnerPayoutSending, pot.ID, date, w.PayoutStatus)
+	if err != nil {
+		return fmt.Errorf("transferWinner claim error %v", err)
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		return fmt.Errorf("transferWinner claim error payout changed")
+	}
+	resp, err := Wallet.TransferSplit(tsr)
+	var randomOutsErr bool
+	if err != nil {
+		if monerorpc.IsOutcomeUnknown(err) {
+			return flagPayoutReview(db, pot.ID, date, err)
+		}
+		randomOutsErr = monerorpc.IsOutsError(err)
+		if !randomOutsErr {
+			// the wallet refused it so nothing was sent, the job can try again
+			if _, rerr := db.Exec(`UPDATE winners SET payout_status = $1 WHERE pot_id = $2 AND date = $3`,
+				w.PayoutStatus, pot.ID, date); rerr != nil {
+				return flagPayoutReview(db, pot.ID, date, fmt.Errorf("%v, reset status error %v", err, rerr))
+			}
+			lockedEvent("transferWinner transfer error " + err.Error() + "\nPayload: \n" + *w.TransferBody)
+			return fmt.Errorf("transferWinner transfer error %v", err)
+		}
+	}
+	// the one at a time fallback records each payout as it goes
+	var payouts []Payout
+	if !randomOutsErr {
+		payouts = splitPayouts(pot.ID, date, tsr, resp)
+	}
+	if err := clearTransferBody(db, pot.ID, date, WinnerPayoutSent, payouts); err != nil {
+		payoutLog.Error("clear transfer body failed", "pot_id", pot.ID, "month", date, "error", err)
+		lockedEvent("transferWinner failed to null transfer_body: " + err.Error())
+	} else if randomOutsErr {
+		// try to send this 1 at a time, and not retry anymore
+		// todo if it still fails we can do a sweep to itself?
+		var failedTransfers []string
+		for _, v := range tsr.Destinations {
+			tresp, err := Wallet.Transfer(&monerorpc.TransferRequest{
+				Destinations: []monerorpc.Destination{
+					{Amount: v.Amount, Address: v.Address},
+				},
+				AccountIndex: tsr.AccountIndex,
+				GetTxKeys:    true,
+			})
+			if err != nil {
+				failedTransfers = append(failedTransfers,
+					fmt.Sprintf("Address: %s \nAmount: %s \nXMR: %d \nError %s",
+						v.Address, monerorpc.XMRToDecimal(v.Amount), v.Amount, err.Error()))
+			}
+			payout := transferPayout(pot.ID, date, v, tresp, err)
+			if err := payout.Save(db); err != nil {
+				payoutLog.Error("save payout failed", "pot_id", pot.ID, "month", date, "error", err)
+			}
+		}
+		if len(failedTransfers) > 0 {
+			lockedEvent("transferWinner transfer failed --\n" + strings.Join(failedTransfers, "\n-----\n"))
+		}
+	}
 	return nil
 }
 
-func RunPickWinnerManually() {
-	log.Println("Running pick winner manually")
-	if pickWinnerTimer != nil {
-		pickWinnerTimer.Stop()
-		pickWinnerTimer = nil
+// clearTransferBody marks the draw paid and records its payouts together
+func clearTransferBody(db *sqlx.DB, potID int64, date string, status string, payouts []Payout) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE winners SET transfer_body = NULL, payout_status = $1 WHERE pot_id = $2 AND date = $3`,
+		status, potID, date); err != nil {
+		return fmt.Errorf("%v -> Rollback: %v", err, tx.Rollback())
+	}
+	for _, payout := range payouts {
+		if err := payout.Save(tx); err != nil {
+			return fmt.Errorf("%v -> Rollback: %v", err, tx.Rollback())
+		}
+	}
+	return tx.Commit()
+}
+
+// DrawWinners scores entries 1 to totalEntries against the block hash and returns
+// the ids sharing the highest score, this must stay in sync with published draws
+func DrawWinners(selector WinnerSelector, block string, signKey string, totalEntries int) ([]int, int) {
+	tiers := DrawTiers(selector, block, signKey, totalEntries, 1)
+	if len(tiers) == 0 {
+		return nil, 0
+	}
+	return tiers[0].Entries, tiers[0].Score
+}
+
+// DrawTiers groups entries by descending score, one tier per distinct score up to maxTiers
+func DrawTiers(selector WinnerSelector, block string, signKey string, totalEntries int, maxTiers int) []DrawTier {
+	byScore := make(map[int][]int)
+	var scores []int
+	for i := 1; i <= totalEntries; i++ {
+		h := selector.Score(block, signKey, int64(i), int64(totalEntries))
+		if _, ok := byScore[h]; !ok {
+			scores = append(scores, h)
+		}
+		byScore[h] = append(byScore[h], i)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+	var tiers []DrawTier
+	for _, score := range scores {
+		if len(tiers) >= maxTiers {
+			break
+		}
+		tiers = append(tiers, DrawTier{Score: score, Entries: byScore[score]})
+	}
+	return tiers
+}
+
+func RunPickWinnerManually(potID int64) error {
+	drawLog.Info("running pick winner manually", "pot_id", potID)
+	return RunCronJob((&Pot{ID: potID}).drawJob())
+}
+
+// transferFileName keeps the original name for the first pot
+func transferFileName(potID int64, month string) string {
+	if potID == DefaultPotID {
+		return month + ".json"
 	}
-	runPickWinner()
+	return fmt.Sprintf("%d-%s.json", potID, month)
 }
@@ -1,13 +1,15 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"moneropot/monerorpc"
+	"moneropot/monerorpc/fake"
 	"moneropot/util"
-	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -16,89 +18,48 @@ func TestPickWinner(t *testing.T) {
 	util.Now = func() time.Time {
 		return time.Date(2021, 11, 20, 0, 0, 0, 0, time.UTC)
 	}
-	os.Setenv("DB_NAME", ":memory:")
-	util.ParseArgs()
-	Init()
-	newAmounts := make(map[int64]uint64)
-	addrIndex := 0
-	monerorpc.SetFakeResponse("create_address", func(in interface{}) string {
-		addrIndex++
-		addr := util.RandomString(95)
-		return fmt.Sprintf(`{"address":"%s","address_index":%d}`, addr, addrIndex)
-	})
-	monerorpc.SetFakeResponse("get_transfers", func(i interface{}) string {
-		return `{"in":[]}`
-	})
-	monerorpc.SetFakeResponse("get_last_block_header", func(i interface{}) string {
-		return `{"block_header":{"hash":"b417bda53fb674146f18777c0d42bbc3bb5e110ee22acec108e7b40e6addc767","height":2496780,"timestamp":1637336695}}`
-	})
-	// firstBlock := "771fbcd656ec1464d3a02ead5e18644030007a0fc664c0a964d30922821a8148"
+	newAmounts := make(map[int64][]payment)
 	firstBlock := "6666666666ec1464d3a02ead5e18644030007a0fc664c0a964d30408821a8bb0"
-	monerorpc.SetFakeResponse("get_block_headers_range", func(i interface{}) string {
-		return fmt.Sprintf(`{"headers":[
-			{"hash":"771fbcd656ec1464d3a02ead5e18644030007a0fc664c0a964d30922821a8148","height":1,"timestamp":1397818193},
-			{"hash":"%s","height":2496780,"timestamp":1637336695}
-		]}`, firstBlock)
-	})
-	monerorpc.SetFakeResponse("get_balance", func(i interface{}) string {
-		return `{
-			"balance": 5000000000000,
-			"unlocked_balance": 5000000000000
-		}`
-	})
-	transferred := make(map[string]uint64)
-	monerorpc.SetFakeResponse("transfer_split", func(i interface{}) string {
-		tsr, ok := i.(**monerorpc.TransferSplitRequest)
-		if !ok {
-			t.Fatalf("Invalid type: %T", i)
-		}
-		ts := *tsr
-		var total uint64
-		for _, dest := range ts.Destinations {
-			v, ok := transferred[dest.Address]
-			if !ok {
-				transferred[dest.Address] = 0
-			}
-			transferred[dest.Address] = v + dest.Amount
-			total += dest.Amount
-		}
-		if total != 3914285714285 {
-			t.Errorf("Wanted total transfer 3914285714285 got %d", total)
-		}
-		return `{}`
-	})
+	fakeRPC.SetBlockHash(fakeRPC.HeightAt(uint64(time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC).Unix())), firstBlock)
+	fakeRPC.SetBalance(0, 5000000000000, 5000000000000)
 
+	// fixed sign key so the expected matches below stay stable
+	MustDB().Exec(`UPDATE pots SET sign_key = $1, sign_commit = $2 WHERE id = 1`,
+		"90a7e39da756fdb53c55c4e00ff05a70db9083b9f8cfca7354582f756b9d9edf",
+		util.Commitment("90a7e39da756fdb53c55c4e00ff05a70db9083b9f8cfca7354582f756b9d9edf"))
+	pot, err := GetPot(DefaultPotID)
+	if err != nil {
+		t.Fatalf("get pot error %v", err)
+	}
 	uname := "ABC"
 	// create 10 accounts and 20 entries
-	var (
-		acct *Account
-		err  error
-	)
+	var acct *Account
 	for i := 0; i < 9; i++ {
 		if i == 0 {
-			acct, err = GetAccount(util.RandomString(94)+strconv.Itoa(i), &uname, nil)
+			acct, err = GetAccount(context.Background(), pot, util.RandomString(94)+strconv.Itoa(i), &uname, nil)
 		} else {
-			acct, err = GetAccount(util.RandomString(94)+strconv.Itoa(i), nil, &uname)
+			acct, err = GetAccount(context.Background(), pot, util.RandomString(94)+strconv.Itoa(i), nil, &uname)
 		}
 		if err != nil {
 			t.Errorf("get account error %v", err)
 		}
-		newAmounts[acct.ID] = CurrentPrice
+		amount := CurrentPrice
 		if i%2 == 0 {
-			newAmounts[acct.ID] += CurrentPrice
+			amount += CurrentPrice
 		}
 		if acct.ID == 5 {
-			newAmounts[acct.ID] += 50
+			amount += 50
 		}
+		newAmounts[acct.ID] = []payment{{amount: amount, price: CurrentPrice}}
 	}
 	tx, err := MustDB().Begin()
 	if err != nil {
 		t.Errorf("test pick winner tx error %v", err)
 	}
-	if err := createNewEntries(tx, newAmounts, 50); err != nil {
+	if err := commitNewEntries(tx, map[int64]map[int64][]payment{pot.ID: newAmounts}, 50); err != nil {
 		t.Errorf("test pick winner new entries error %v", err)
 	}
-	entries, err := TotalEntries()
+	entries, err := TotalEntries(pot.ID)
 	if err != nil {
 		t.Errorf("total entries error %v", err)
 	}
@@ -127,10 +88,36 @@ func TestPickWinner(t *testing.T) {
 		}
 		log.Println("AllEntries", entry.ID, entry.AccountID, entry.Hash, util.HashMatchAlign(firstBlock, entry.Hash))
 	}
-	signKey, _ := GetMetadata("sign_key", "----------------")
-	if err := pickWinner(); err != nil {
+	signKey := pot.SignKey
+	// changing the algorithm during the round only applies to the next one
+	if err := pot.SetDrawAlgorithm("mod"); err != nil {
+		t.Errorf("set draw algorithm error %v", err)
+	}
+	if err := pickWinner(pot, util.UtcNow()); err != nil {
 		t.Errorf("pick winner error %v", err)
 	}
+	// the payout is queued with the draw
+	processJobs()
+	var payoutStatus string
+	if err := dbx.Get(&payoutStatus, `SELECT status FROM jobs WHERE type = $1`, JobPayout); err != nil {
+		t.Errorf("pick winner select payout job error %v", err)
+	}
+	if payoutStatus != JobDone {
+		t.Errorf("Wanted payout job %s got %s", JobDone, payoutStatus)
+	}
+	txs := fakeRPC.Txs()
+	if len(txs) != 1 || !txs[0].Relayed {
+		t.Fatalf("Wanted 1 relayed transfer got %v", txs)
+	}
+	transferred := make(map[string]uint64)
+	var total uint64
+	for _, dest := range txs[0].Destinations {
+		transferred[dest.Address] += dest.Amount
+		total += dest.Amount
+	}
+	if total != 3914285714285 {
+		t.Errorf("Wanted total transfer 3914285714285 got %d", total)
+	}
 	winner := Winner{}
 	if err := dbx.Get(&winner, `SELECT * FROM winners`); err != nil {
 		t.Errorf("pick winner select winner error %v", err)
@@ -149,6 +136,18 @@ func TestPickWinner(t *testing.T) {
 	if info.SignKey != signKey {
 		t.Errorf("Wanted info.SignKey %s got %s", signKey, info.SignKey)
 	}
+	if info.Algorithm != DefaultAlgorithm {
+		t.Errorf("Wanted the round drawn with %s got %s", DefaultAlgorithm, info.Algorithm)
+	}
+	if len(info.Tiers) != 1 || info.Tiers[0].Amount != info.Amount || info.Tiers[0].Score != 8 {
+		t.Errorf("Wanted 1 tier matching the winner got %v", info.Tiers)
+	}
+	if info.Split == nil || info.Split.Winner != 70 || info.Split.Referrals != 15 {
+		t.Errorf("Wanted info.Split 70/15/10/5 got %v", info.Split)
+	}
+	if info.Commitment != util.Commitment(signKey) {
+		t.Errorf("Wanted info.Commitment %s got %s", util.Commitment(signKey), info.Commitment)
+	}
 	winners := make(map[int]string)
 	for addr, entries := range info.Accounts {
 		for _, entry := range entries {
@@ -168,13 +167,54 @@ func TestPickWinner(t *testing.T) {
 	if transferred[util.Config.FundAddress] != 200000000000 {
 		t.Errorf("Wanted fund amount 20000000000 got %d", transferred[util.Config.FundAddress])
 	}
-	entryID, _ := GetMetadata("entry_id", "1000")
-	if entryID != "0" {
-		t.Errorf("Wanted entry_id of '0' got '%s'", entryID)
+	var payouts []Payout
+	if err := dbx.Select(&payouts, `SELECT * FROM payouts WHERE pot_id = $1 AND month = $2`, pot.ID, "2021-10"); err != nil {
+		t.Errorf("pick winner select payouts error %v", err)
+	}
+	if len(payouts) != len(transferred) {
+		t.Errorf("Wanted %d payouts got %d", len(transferred), len(payouts))
+	}
+	var payoutFees uint64
+	for _, payout := range payouts {
+		if payout.TxHash == nil || *payout.TxHash != txs[0].Hash || payout.TxKey == nil || *payout.TxKey != txs[0].Key {
+			t.Errorf("Wanted payout tx %s key %s got %v %v", txs[0].Hash, txs[0].Key, payout.TxHash, payout.TxKey)
+		}
+		if payout.Amount != transferred[payout.Destination] || payout.Status != PayoutSent {
+			t.Errorf("Wanted payout %d sent got %d %s", transferred[payout.Destination], payout.Amount, payout.Status)
+		}
+		payoutFees += payout.Fee
+	}
+	if payoutFees > fake.DefaultFee || payoutFees < fake.DefaultFee-uint64(len(payouts)) {
+		t.Errorf("Wanted payout fees to add up to %d got %d", fake.DefaultFee, payoutFees)
+	}
+	fakeRPC.Mine(12)
+	if err := checkPayouts(); err != nil {
+		t.Errorf("check payouts error %v", err)
+	}
+	payouts = nil
+	if err := dbx.Select(&payouts, `SELECT * FROM payouts WHERE status = $1`, PayoutConfirmed); err != nil {
+		t.Errorf("pick winner select confirmed payouts error %v", err)
+	}
+	if len(payouts) != len(transferred) || payouts[0].Confirmations != 12 || payouts[0].Height != 2496781 {
+		t.Errorf("Wanted %d confirmed payouts got %v", len(transferred), payouts)
+	}
+	// confirmed payouts aren't looked up again
+	calls := fakeRPC.Calls("get_transfers")
+	if err := checkPayouts(); err != nil || fakeRPC.Calls("get_transfers") != calls {
+		t.Errorf("Wanted no transfers looked up without payouts to check got %d calls %v", fakeRPC.Calls("get_transfers")-calls, err)
+	}
+	pot, _ = GetPot(pot.ID)
+	if pot.EntryID != 0 {
+		t.Errorf("Wanted entry_id of 0 got %d", pot.EntryID)
 	}
-	signKey, _ = GetMetadata("sign_key", "")
-	if signKey != firstBlock {
-		t.Errorf("Wanted sign_key of '%s' got '%s'", firstBlock, signKey)
+	if pot.SignKey == signKey || len(pot.SignKey) != 64 {
+		t.Errorf("Wanted new sign_key got '%s'", pot.SignKey)
+	}
+	if pot.DrawAlgorithm != "mod" || pot.NextDrawAlgorithm != "" {
+		t.Errorf("Wanted mod for the new round got %q next %q", pot.DrawAlgorithm, pot.NextDrawAlgorithm)
+	}
+	if pot.SignCommit != util.Commitment(pot.SignKey) {
+		t.Errorf("Wanted sign_commit of '%s' got '%s'", util.Commitment(pot.SignKey), pot.SignCommit)
 	}
 	if entries != info.Entries {
 		t.Errorf("Wanted entries %d got %d", entries, info.Entries)
@@ -194,6 +234,449 @@ func TestPickWinner(t *testing.T) {
 	if count != 1 {
 		t.Errorf("Wanted active count 1 got %d", count)
 	}
-	// todo maybe do more tests here
 
+	// approval mode previews the transfer and only relays it once approved
+	util.Config.PayoutApproval = true
+	defer func() {
+		util.Config.PayoutApproval = false
+	}()
+	if _, err := dbx.Exec(`INSERT INTO winners (pot_id, date, info, transfer_body) VALUES ($1, $2, $3, $4)`,
+		pot.ID, "2021-11", "{}", `{"account_index":0,"destinations":[{"amount":1000,"address":"aa"},{"amount":3000,"address":"bb"}]}`); err != nil {
+		t.Errorf("insert pending winner error %v", err)
+	}
+	if err := transferWinner(pot, "2021-11"); err != nil {
+		t.Errorf("transfer winner preview error %v", err)
+	}
+	txs = fakeRPC.Txs()
+	preview := txs[len(txs)-1]
+	pending, err := GetPendingPayouts()
+	if err != nil {
+		t.Errorf("pending payouts error %v", err)
+	}
+	if len(pending) != 1 || pending[0].Fee != fake.DefaultFee || len(pending[0].Destinations) != 2 || preview.Relayed {
+		t.Errorf("Wanted 1 unrelayed pending payout with fee %d got %v %v", fake.DefaultFee, pending, preview)
+	}
+	if err := ApprovePayout(pot.ID, "2021-11"); err != nil {
+		t.Errorf("approve payout error %v", err)
+	}
+	txs = fakeRPC.Txs()
+	if relayed := txs[len(txs)-1]; relayed.Hash != preview.Hash || !relayed.Relayed {
+		t.Errorf("Wanted the previewed transfer relayed got %v", txs)
+	}
+	payouts = nil
+	if err := dbx.Select(&payouts, `SELECT * FROM payouts WHERE month = $1 ORDER BY amount`, "2021-11"); err != nil {
+		t.Errorf("select approved payouts error %v", err)
+	}
+	if len(payouts) != 2 || *payouts[0].TxHash != preview.Hash || payouts[0].Fee != 7500000 || payouts[1].Fee != 22500000 {
+		t.Errorf("Wanted 2 approved payouts got %v", payouts)
+	}
+	if err := ApprovePayout(pot.ID, "2021-11"); err != ErrNoPendingPayout {
+		t.Errorf("Wanted approved payout to be done got %v", err)
+	}
+
+	// view-only wallets export the transfer unsigned and submit it once signed offline
+	util.Config.ViewOnly = true
+	fakeRPC.SetViewOnly(true)
+	defer func() {
+		util.Config.ViewOnly = false
+		fakeRPC.SetViewOnly(false)
+	}()
+	if _, err := dbx.Exec(`INSERT INTO winners (pot_id, date, info, transfer_body) VALUES ($1, $2, $3, $4)`,
+		pot.ID, "2021-12", "{}", `{"account_index":0,"destinations":[{"amount":2000,"address":"aa"},{"amount":2000,"address":"bb"}]}`); err != nil {
+		t.Errorf("insert unsigned winner error %v", err)
+	}
+	if err := transferWinner(pot, "2021-12"); err != nil {
+		t.Errorf("transfer winner unsigned error %v", err)
+	}
+	statusOf := func(date string) string {
+		var status string
+		if err := dbx.Get(&status, `SELECT payout_status FROM winners WHERE pot_id = $1 AND date = $2`, pot.ID, date); err != nil {
+			t.Errorf("select payout status error %v", err)
+		}
+		return status
+	}
+	txset, err := GetUnsignedTxset(pot.ID, "2021-12")
+	if err != nil || txset == "" {
+		t.Errorf("Wanted unsigned txset got %s %v", txset, err)
+	}
+	pending, err = GetPendingPayouts()
+	if err != nil || len(pending) != 1 || pending[0].Status != WinnerPayoutUnsigned || pending[0].Fee != fake.DefaultFee {
+		t.Errorf("Wanted 1 unsigned payout got %v %v", pending, err)
+	}
+	signed, err := fakeRPC.Client().SignTransfer(&monerorpc.SignTransferRequest{UnsignedTxset: txset, GetTxKeys: true})
+	if err != nil {
+		t.Fatalf("sign transfer error %v", err)
+	}
+	if err := SubmitSignedPayout(pot.ID, "2021-12", &monerorpc.SignTransferResponse{SignedTxset: signed.SignedTxset}); err != ErrSignedPayoutMismatch {
+		t.Errorf("Wanted a signed payout without tx hashes refused got %v", err)
+	}
+	// a signed tx paying something else is relayed before it can be checked, it's left for review
+	other, err := fakeRPC.Client().TransferSplit(&monerorpc.TransferSplitRequest{
+		Destinations: []monerorpc.Destination{{Amount: 2000, Address: "aa"}, {Amount: 2000, Address: "cc"}},
+	})
+	if err != nil {
+		t.Fatalf("other transfer error %v", err)
+	}
+	otherSigned, err := fakeRPC.Client().SignTransfer(&monerorpc.SignTransferRequest{UnsignedTxset: other.UnsignedTxset, GetTxKeys: true})
+	if err != nil {
+		t.Fatalf("sign other transfer error %v", err)
+	}
+	if err := SubmitSignedPayout(pot.ID, "2021-12", otherSigned); err == nil {
+		t.Errorf("Wanted a signed payout paying other destinations to fail")
+	}
+	if status := statusOf("2021-12"); status != WinnerPayoutReview {
+		t.Errorf("Wanted the mismatched payout in review got %s", status)
+	}
+	if err := ResolvePayout(pot.ID, "2021-12", false); err != nil {
+		t.Errorf("resolve payout error %v", err)
+	}
+	if status := statusOf("2021-12"); status != WinnerPayoutUnsigned {
+		t.Errorf("Wanted the resolved payout unsigned again got %s", status)
+	}
+	if err := SubmitSignedPayout(pot.ID, "2021-12", signed); err != nil {
+		t.Errorf("submit signed payout error %v", err)
+	}
+	txs = fakeRPC.Txs()
+	if !txs[len(txs)-1].Relayed {
+		t.Errorf("Wanted the signed transfer relayed got %v", txs[len(txs)-1])
+	}
+	payouts = nil
+	if err := dbx.Select(&payouts, `SELECT * FROM payouts WHERE month = $1 ORDER BY destination`, "2021-12"); err != nil {
+		t.Errorf("select signed payouts error %v", err)
+	}
+	if len(payouts) != 2 || *payouts[0].TxHash != signed.TxHashList[0] || *payouts[0].TxKey != signed.TxKeyList[0] ||
+		payouts[0].Fee != fake.DefaultFee/2 {
+		t.Errorf("Wanted 2 signed payouts got %v", payouts)
+	}
+	if _, err := GetUnsignedTxset(pot.ID, "2021-12"); err != ErrNoPendingPayout {
+		t.Errorf("Wanted signed payout to be done got %v", err)
+	}
+
+	// a submit that lost its response may have been relayed
+	if _, err := dbx.Exec(`INSERT INTO winners (pot_id, date, info, transfer_body) VALUES ($1, $2, $3, $4)`,
+		pot.ID, "2022-04", "{}", `{"account_index":0,"destinations":[{"amount":3000,"address":"aa"}]}`); err != nil {
+		t.Errorf("insert unsigned winner error %v", err)
+	}
+	if err := transferWinner(pot, "2022-04"); err != nil {
+		t.Errorf("transfer winner unsigned error %v", err)
+	}
+	if txset, err = GetUnsignedTxset(pot.ID, "2022-04"); err != nil {
+		t.Fatalf("unsigned txset error %v", err)
+	}
+	if signed, err = fakeRPC.Client().SignTransfer(&monerorpc.SignTransferRequest{UnsignedTxset: txset, GetTxKeys: true}); err != nil {
+		t.Fatalf("sign transfer error %v", err)
+	}
+	fakeRPC.DropResponse("submit_transfer", 1)
+	if err := SubmitSignedPayout(pot.ID, "2022-04", signed); err == nil {
+		t.Errorf("Wanted a submit without response to fail")
+	}
+	if status := statusOf("2022-04"); status != WinnerPayoutReview {
+		t.Errorf("Wanted the unknown submit in review got %s", status)
+	}
+	if err := ResolvePayout(pot.ID, "2022-04", true); err != nil {
+		t.Errorf("resolve payout error %v", err)
+	}
+	payouts = nil
+	if err := dbx.Select(&payouts, `SELECT * FROM payouts WHERE month = $1`, "2022-04"); err != nil {
+		t.Errorf("select resolved payouts error %v", err)
+	}
+	if len(payouts) != 1 || *payouts[0].TxHash != signed.TxHashList[0] || statusOf("2022-04") != WinnerPayoutSent {
+		t.Errorf("Wanted the resolved payout sent with the signed tx got %v", payouts)
+	}
+}
+
+func TestTransferWinnerReview(t *testing.T) {
+	fakeRPC.SetBalance(0, 5000000000000, 5000000000000)
+	pot, err := GetPot(DefaultPotID)
+	if err != nil {
+		t.Fatalf("get pot error %v", err)
+	}
+	body := `{"account_index":0,"destinations":[{"amount":1000,"address":"aa"}]}`
+	if _, err := dbx.Exec(`INSERT INTO winners (pot_id, date, info, transfer_body) VALUES ($1, $2, $3, $4), ($1, $5, $3, $4)`,
+		pot.ID, "2022-01", "{}", body, "2022-02"); err != nil {
+		t.Fatalf("insert winners error %v", err)
+	}
+	status := func(date string) (string, bool) {
+		w := &Winner{}
+		if err := dbx.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, pot.ID, date); err != nil {
+			t.Fatalf("select winner error %v", err)
+		}
+		return w.PayoutStatus, w.TransferBody != nil
+	}
+
+	// the wallet relays the transfer but the answer is lost, it must not be sent again
+	fakeRPC.DropResponse("transfer_split", 1)
+	calls := fakeRPC.Calls("transfer_split")
+	if err := transferWinner(pot, "2022-01"); err != nil {
+		t.Errorf("transfer winner error %v", err)
+	}
+	if st, _ := status("2022-01"); st != WinnerPayoutReview {
+		t.Errorf("Wanted payout for review got %q", st)
+	}
+	if err := runPayoutJob(`{"pot_id":1,"date":"2022-01"}`); err != nil {
+		t.Errorf("payout job error %v", err)
+	}
+	if n := fakeRPC.Calls("transfer_split") - calls; n != 1 {
+		t.Errorf("Wanted transfer_split once got %d", n)
+	}
+	if err := ResolvePayout(pot.ID, "2022-01", true); err != nil {
+		t.Errorf("resolve payout error %v", err)
+	}
+	if st, pending := status("2022-01"); st != WinnerPayoutSent || pending {
+		t.Errorf("Wanted resolved payout sent got %q %v", st, pending)
+	}
+
+	// a payout left sending by a crash is flagged, sent again once resolved as not sent
+	if _, err := dbx.Exec(`UPDATE winners SET payout_status = $1 WHERE pot_id = $2 AND date = $3`,
+		WinnerPayoutSending, pot.ID, "2022-02"); err != nil {
+		t.Fatalf("update winner error %v", err)
+	}
+	calls = fakeRPC.Calls("transfer_split")
+	if err := transferWinner(pot, "2022-02"); err != nil {
+		t.Errorf("transfer winner error %v", err)
+	}
+	if st, _ := status("2022-02"); st != WinnerPayoutReview || fakeRPC.Calls("transfer_split") != calls {
+		t.Errorf("Wanted sending payout for review without a transfer got %q", st)
+	}
+	if err := ResolvePayout(pot.ID, "2022-02", false); err != nil {
+		t.Errorf("resolve payout error %v", err)
+	}
+	if err := transferWinner(pot, "2022-02"); err != nil {
+		t.Errorf("transfer winner error %v", err)
+	}
+	if st, pending := status("2022-02"); st != WinnerPayoutSent || pending || fakeRPC.Calls("transfer_split") != calls+1 {
+		t.Errorf("Wanted payout sent again got %q %v", st, pending)
+	}
+	if err := ResolvePayout(pot.ID, "2022-02", true); err != ErrNoPendingPayout {
+		t.Errorf("Wanted no payout to resolve got %v", err)
+	}
+}
+
+func TestApprovePayoutPartlyRelayed(t *testing.T) {
+	pot, err := GetPot(DefaultPotID)
+	if err != nil {
+		t.Fatalf("get pot error %v", err)
+	}
+	// a preview of two txs, the second relay fails the first time
+	preview := &monerorpc.TransferSplitResponse{}
+	body := `{"account_index":0,"destinations":[{"amount":1000,"address":"aa"},{"amount":2000,"address":"bb"}]}`
+	for _, amount := range []uint64{1000, 2000} {
+		resp, err := fakeRPC.Client().TransferSplit(&monerorpc.TransferSplitRequest{
+			Destinations: []monerorpc.Destination{{Amount: amount, Address: "aa"}},
+			DoNotRelay:   true, GetTxMetadata: true, GetTxKeys: true,
+		})
+		if err != nil {
+			t.Fatalf("transfer split error %v", err)
+		}
+		preview.TxHashList = append(preview.TxHashList, resp.TxHashList...)
+		preview.TxKeyList = append(preview.TxKeyList, resp.TxKeyList...)
+		preview.TxMetadataList = append(preview.TxMetadataList, resp.TxMetadataList...)
+		preview.AmountList = append(preview.AmountList, resp.AmountList...)
+		preview.FeeList = append(preview.FeeList, resp.FeeList...)
+	}
+	b, _ := json.Marshal(preview)
+	if _, err := dbx.Exec(`INSERT INTO winners (pot_id, date, info, transfer_body, payout_status, payout_preview)
+		VALUES ($1, $2, $3, $4, $5, $6)`, pot.ID, "2022-03", "{}", body, WinnerPayoutPendingApproval, string(b)); err != nil {
+		t.Fatalf("insert winner error %v", err)
+	}
+	relay := fakeRPC.Handler("relay_tx")
+	defer fakeRPC.Handle("relay_tx", relay)
+	fakeRPC.Handle("relay_tx", func(params json.RawMessage) (interface{}, error) {
+		if strings.Contains(string(params), preview.TxMetadataList[1]) {
+			return nil, &monerorpc.RPCError{Code: -4, Message: "daemon busy"}
+		}
+		return relay(params)
+	})
+	if err := ApprovePayout(pot.ID, "2022-03"); err == nil {
+		t.Errorf("Wanted relay error")
+	}
+	w := &Winner{}
+	if err := dbx.Get(w, `SELECT * FROM winners WHERE pot_id = $1 AND date = $2`, pot.ID, "2022-03"); err != nil {
+		t.Fatalf("select winner error %v", err)
+	}
+	if w.PayoutStatus != WinnerPayoutPendingApproval || w.PayoutRelayed != preview.TxHashList[0] {
+		t.Errorf("Wanted first tx kept relayed got %q %q", w.PayoutStatus, w.PayoutRelayed)
+	}
+	if err := DiscardPayout(pot.ID, "2022-03"); err != ErrPayoutPartlyRelayed {
+		t.Errorf("Wanted partly relayed payout not discarded got %v", err)
+	}
+	// the first tx is relayed already, relaying it again would fail
+	fakeRPC.Handle("relay_tx", relay)
+	if err := ApprovePayout(pot.ID, "2022-03"); err != nil {
+		t.Errorf("approve payout again error %v", err)
+	}
+	var payouts []Payout
+	if err := dbx.Select(&payouts, `SELECT * FROM payouts WHERE month = $1`, "2022-03"); err != nil || len(payouts) != 2 {
+		t.Errorf("Wanted 2 payouts got %v %v", payouts, err)
+	}
+	for _, tx := range fakeRPC.Txs() {
+		if (tx.Hash == preview.TxHashList[0] || tx.Hash == preview.TxHashList[1]) && !tx.Relayed {
+			t.Errorf("Wanted tx %s relayed", tx.Hash)
+		}
+	}
+}
+
+func TestDrawWinners(t *testing.T) {
+	block := "6666666666ec1464d3a02ead5e18644030007a0fc664c0a964d30408821a8bb0"
+	signKey := "90a7e39da756fdb53c55c4e00ff05a70db9083b9f8cfca7354582f756b9d9edf"
+	tables := []struct {
+		algorithm string
+		score     int
+		winners   []int
+	}{
+		{"", 8, []int{5}},
+		{"align", 8, []int{5}},
+		{"char", 46, []int{3}},
+		{"mod", 14, []int{13}},
+	}
+	for _, table := range tables {
+		sel, err := GetWinnerSelector(table.algorithm)
+		if err != nil {
+			t.Fatalf("selector %s error %v", table.algorithm, err)
+		}
+		winners, score := DrawWinners(sel, block, signKey, 14)
+		if score != table.score {
+			t.Errorf("Wanted %s score %d got %d", table.algorithm, table.score, score)
+		}
+		if fmt.Sprint(winners) != fmt.Sprint(table.winners) {
+			t.Errorf("Wanted %s winners %v got %v", table.algorithm, table.winners, winners)
+		}
+	}
+	sel, _ := GetWinnerSelector(DefaultAlgorithm)
+	tiers := DrawTiers(sel, block, signKey, 14, 3)
+	if fmt.Sprint(tiers) != "[{8 [5]} {7 [1 8]} {5 [2 6 14]}]" {
+		t.Errorf("Wanted 3 tiers got %v", tiers)
+	}
+	if _, err := GetWinnerSelector("nope"); err == nil {
+		t.Errorf("Wanted unknown algorithm error")
+	}
+}
+
+func TestPickWinnerTiers(t *testing.T) {
+	now, split := util.Now, util.Config.Split
+	defer func() {
+		util.Now, util.Config.Split = now, split
+	}()
+	util.Now = func() time.Time {
+		return time.Date(2021, 11, 20, 0, 0, 0, 0, time.UTC)
+	}
+	pot, err := CreatePot("tiers", ScheduleWeekly)
+	if err != nil {
+		t.Fatalf("create pot error %v", err)
+	}
+	fakeRPC.SetBalance(pot.AccountIndex, 5000000000000, 5000000000000)
+	signKey := "90a7e39da756fdb53c55c4e00ff05a70db9083b9f8cfca7354582f756b9d9edf"
+	if _, err := dbx.Exec(`UPDATE pots SET sign_key = $1, sign_commit = $2 WHERE id = $3`,
+		signKey, util.Commitment(signKey), pot.ID); err != nil {
+		t.Fatalf("update pot error %v", err)
+	}
+	newAmounts := make(map[int64][]payment)
+	for i := 0; i < 8; i++ {
+		acct, err := GetAccount(context.Background(), pot, util.RandomString(94)+strconv.Itoa(i), nil, nil)
+		if err != nil {
+			t.Fatalf("get account error %v", err)
+		}
+		newAmounts[acct.ID] = []payment{{amount: CurrentPrice, price: CurrentPrice}}
+	}
+	h, _ := LastHeight()
+	tx, err := MustDB().Begin()
+	if err != nil {
+		t.Fatalf("tx error %v", err)
+	}
+	if err := commitNewEntries(tx, map[int64]map[int64][]payment{pot.ID: newAmounts}, h); err != nil {
+		t.Fatalf("new entries error %v", err)
+	}
+
+	util.Config.Split.Tiers = nil
+	if err := pickWinner(pot, util.UtcNow()); err == nil {
+		t.Errorf("Wanted an error without prize tiers")
+	}
+	util.Config.Split.Tiers = []float64{40, 20, 10}
+	amt, err := GetDistributedAmounts(context.Background(), pot, false)
+	if err != nil {
+		t.Fatalf("distributed amounts error %v", err)
+	}
+	if err := pickWinner(pot, util.UtcNow()); err != nil {
+		t.Fatalf("pick winner error %v", err)
+	}
+	w := &Winner{}
+	if err := dbx.Get(w, `SELECT * FROM winners WHERE pot_id = $1`, pot.ID); err != nil || w.TransferBody == nil {
+		t.Fatalf("select winner error %v", err)
+	}
+	info := WinnerInfo{}
+	if err := json.Unmarshal([]byte(w.Info), &info); err != nil {
+		t.Fatalf("winner info error %v", err)
+	}
+	tsr := &monerorpc.TransferSplitRequest{}
+	if err := json.Unmarshal([]byte(*w.TransferBody), tsr); err != nil {
+		t.Fatalf("transfer body error %v", err)
+	}
+	if len(info.Tiers) != 3 {
+		t.Fatalf("Wanted 3 tiers got %v", info.Tiers)
+	}
+	// each tier is split between its entries, an account can win more than one tier
+	want := make(map[string]uint64)
+	var tierTotal int64
+	for i, tier := range info.Tiers {
+		if tier.Amount != int64(amt.Tiers[i]) {
+			t.Errorf("Wanted tier %d amount %d got %d", i+1, amt.Tiers[i], tier.Amount)
+		}
+		if i > 0 && tier.Score >= info.Tiers[i-1].Score {
+			t.Errorf("Wanted tier %d below the score %d got %d", i+1, info.Tiers[i-1].Score, tier.Score)
+		}
+		tierTotal += tier.Amount
+		var entries int
+		for _, ids := range tier.Accounts {
+			entries += len(ids)
+		}
+		for address, ids := range tier.Accounts {
+			want[address] += uint64(float64(tier.Amount) * (float64(len(ids)) / float64(entries)))
+		}
+	}
+	if amt.Winner == 0 {
+		t.Fatalf("Wanted a winner share")
+	}
+	if diff := int64(amt.Winner) - tierTotal; diff < 0 || diff > 3 {
+		t.Errorf("Wanted tiers to add up to the winner share %d got %d", amt.Winner, tierTotal)
+	}
+	var paid uint64
+	for _, dest := range tsr.Destinations {
+		if dest.Address == util.Config.MaintAddress || dest.Address == util.Config.FundAddress {
+			continue
+		}
+		if dest.Amount != want[dest.Address] {
+			t.Errorf("Wanted %s paid %d got %d", dest.Address, want[dest.Address], dest.Amount)
+		}
+		paid += dest.Amount
+		delete(want, dest.Address)
+	}
+	if len(want) != 0 {
+		t.Errorf("Wanted a destination for every winner got %d missing", len(want))
+	}
+	if diff := int64(tierTotal) - int64(paid); diff < 0 || diff > 8 {
+		t.Errorf("Wanted winners paid the tiers %d got %d", tierTotal, paid)
+	}
+}
+
+func TestPayoutsMinHeight(t *testing.T) {
+	wh, err := Wallet.GetHeight()
+	if err != nil {
+		t.Fatalf("get height error %v", err)
+	}
+	now := util.UtcNow().Unix()
+	var tests = []struct {
+		payouts []Payout
+		want    uint64
+	}{
+		{[]Payout{{Height: wh.Height - 10}}, wh.Height - 10 - payoutHeightMargin},
+		{[]Payout{{Height: wh.Height - 10}, {AttemptedAt: now - 3600}}, wh.Height - 30 - payoutHeightMargin},
+		{[]Payout{{Height: wh.Height - 100}, {AttemptedAt: now - 3600}}, wh.Height - 100 - payoutHeightMargin},
+		{[]Payout{{Height: payoutHeightMargin}}, 0},
+	}
+	for i, tt := range tests {
+		got, err := payoutsMinHeight(tt.payouts)
+		if err != nil || got != tt.want {
+			t.Errorf("%d wanted min height %d got %d %v", i, tt.want, got, err)
+		}
+	}
 }
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"moneropot/monerorpc"
+	"moneropot/util"
+)
+
+type (
+	// Pot is an independent draw backed by its own wallet account index, NextDrawAlgorithm
+	// replaces DrawAlgorithm when the next round starts
+	Pot struct {
+		ID                int64  `json:"id" db:"id"`
+		Name              string `json:"name" db:"name"`
+		AccountIndex      uint64 `json:"account_index" db:"account_index"`
+		Schedule          string `json:"schedule" db:"schedule"`
+		EntryID           int64  `json:"entries" db:"entry_id"`
+		SignKey           string `json:"-" db:"sign_key"`
+		SignCommit        string `json:"sign_commit" db:"sign_commit"`
+		DrawAlgorithm     string `json:"algorithm" db:"draw_algorithm"`
+		NextDrawAlgorithm string `json:"next_algorithm,omitempty" db:"next_draw_algorithm"`
+		Active            bool   `json:"active" db:"active"`
+	}
+)
+
+const (
+	DefaultPotID = 1
+
+	ScheduleMonthly = "monthly"
+	ScheduleWeekly  = "weekly"
+)
+
+var (
+	ErrPotNotFound = fmt.Errorf("pot not found")
+)
+
+func GetPot(id int64) (*Pot, error) {
+	db := MustDB()
+	pot := &Pot{}
+	if err := db.Get(pot, `SELECT * FROM pots WHERE id = $1`, id); err != nil {
+		if util.NoRows(err) {
+			return nil, ErrPotNotFound
+		}
+		return nil, fmt.Errorf("GetPot error %v", err)
+	}
+	return pot, nil
+}
+
+func GetPots() ([]Pot, error) {
+	db := MustDB()
+	var pots []Pot
+	if err := db.Select(&pots, `SELECT * FROM pots WHERE active = 1 ORDER BY id`); err != nil {
+		return nil, fmt.Errorf("GetPots error %v", err)
+	}
+	return pots, nil
+}
+
+// CreatePot creates a new wallet account for the pot so its balance is kept apart
+func CreatePot(name string, schedule string) (*Pot, error) {
+	if _, err := ParseSchedule(schedule); err != nil {
+		return nil, fmt.Errorf("CreatePot invalid schedule %v", err)
+	}
+	seed, err := util.NewSeed()
+	if err != nil {
+		return nil, fmt.Errorf("CreatePot error %v", err)
+	}
+	resp, err := Wallet.CreateAccount(&monerorpc.CreateAccountRequest{Label: name})
+	if err != nil {
+		return nil, fmt.Errorf("CreatePot create account error %v", err)
+	}
+	pot := &Pot{
+		Name:          name,
+		AccountIndex:  resp.AccountIndex,
+		Schedule:      schedule,
+		SignKey:       seed,
+		SignCommit:    util.Commitment(seed),
+		DrawAlgorithm: DefaultAlgorithm,
+		Active:        true,
+	}
+	db := MustDB()
+	r, err := db.NamedExec(`INSERT INTO pots (name, account_index, schedule, sign_key, sign_commit, draw_algorithm, active)
+		VALUES (:name, :account_index, :schedule, :sign_key, :sign_commit, :draw_algorithm, :active)`, pot)
+	if err != nil {
+		return nil, fmt.Errorf("CreatePot insert error %v", err)
+	}
+	pot.ID, err = r.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("CreatePot insert id error %v", err)
+	}
+	dbLog.Info("created pot", "pot_id", pot.ID, "name", pot.Name, "account_index", pot.AccountIndex)
+	if err := pot.scheduleDraw(); err != nil {
+		return nil, fmt.Errorf("CreatePot schedule error %v", err)
+	}
+	return pot, nil
+}
+
+// initSignCommit starts committing to the sign key when the current round has no entries yet,
+// rounds already in progress keep their public sign key until the next draw
+func (p *Pot) initSignCommit() error {
+	if p.SignCommit != "" || p.EntryID != 0 {
+		return nil
+	}
+	seed, err := util.NewSeed()
+	if err != nil {
+		return fmt.Errorf("initSignCommit error %v", err)
+	}
+	db := MustDB()
+	if _, err := db.Exec(`UPDATE pots SET sign_key = $1, sign_commit = $2 WHERE id = $3`,
+		seed, util.Commitment(seed), p.ID); err != nil {
+		return fmt.Errorf("initSignCommit error %v", err)
+	}
+	p.SignKey = seed
+	p.SignCommit = util.Commitment(seed)
+	drawLog.Info("committed sign key", "pot_id", p.ID, "sign_commit", p.SignCommit)
+	return nil
+}
+
+// SetDrawAlgorithm sets the algorithm from the next round, the current round keeps the one it
+// started with since the operator holding the sign key could otherwise pick the rule that picks the winner
+func (p *Pot) SetDrawAlgorithm(name string) error {
+	if _, err := GetWinnerSelector(name); err != nil {
+		return err
+	}
+	if name == p.DrawAlgorithm {
+		name = ""
+	}
+	db := MustDB()
+	if _, err := db.Exec(`UPDATE pots SET next_draw_algorithm = $1 WHERE id = $2`, name, p.ID); err != nil {
+		return fmt.Errorf("SetDrawAlgorithm error %v", err)
+	}
+	p.NextDrawAlgorithm = name
+	util.Cache.Delete(InfoCacheKey(p.ID))
+	return nil
+}
+
+// SetSchedule changes the draw schedule, a cron expression or monthly/weekly
+func (p *Pot) SetSchedule(schedule string) error {
+	if _, err := ParseSchedule(schedule); err != nil {
+		return err
+	}
+	db := MustDB()
+	if _, err := db.Exec(`UPDATE pots SET schedule = $1 WHERE id = $2`, schedule, p.ID); err != nil {
+		return fmt.Errorf("SetSchedule error %v", err)
+	}
+	p.Schedule = schedule
+	util.Cache.Delete(InfoCacheKey(p.ID))
+	return p.scheduleDraw()
+}
+
+// drawPeriod returns the label of the round being drawn and the start of the new round,
+// the first block at or after the start is used for the draw
+func (p *Pot) drawPeriod(at time.Time) (string, time.Time) {
+	year, month, day := at.Date()
+	switch p.Schedule {
+	case ScheduleWeekly:
+		// weeks start on monday
+		offset := (int(at.Weekday()) + 6) % 7
+		start := time.Date(year, month, day-offset, 0, 0, 0, 0, at.Location())
+		return start.AddDate(0, 0, -7).Format(DateFormat), start
+	case ScheduleMonthly:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, at.Location())
+		return start.AddDate(0, -1, 0).Format("2006-01"), start
+	}
+	// custom schedules are labeled by the draw time
+	start := at.Truncate(time.Minute)
+	return start.Format("2006-01-02T15:04"), start
+}
+
+func (p *Pot) drawJob() string {
+	return "draw:" + strconv.FormatInt(p.ID, 10)
+}
+
+func (p *Pot) scheduleDraw() error {
+	potID := p.ID
+	return ScheduleCron(p.drawJob(), p.Schedule, func(at time.Time) error {
+		return enqueueJob(MustDB(), JobDraw, drawPayload{PotID: potID, At: at})
+	})
+}
+
+// NextDraw is when the pot draws next
+func (p *Pot) NextDraw() time.Time {
+	return NextRun(p.drawJob())
+}
+
+func InfoCacheKey(potID int64) string {
+	return "info:" + strconv.FormatInt(potID, 10)
+}
+
+// refreshInfo drops the cached pot info and tells clients to reload it
+func refreshInfo(potID int64) {
+	util.Cache.Delete(InfoCacheKey(potID))
+	util.PublishTopic("", "info")
+}
+
+func refreshAllInfo() {
+	pots, err := GetPots()
+	if err != nil {
+		dbLog.Error("refresh info failed", "error", err)
+		return
+	}
+	for _, pot := range pots {
+		util.Cache.Delete(InfoCacheKey(pot.ID))
+	}
+	util.PublishTopic("", "info")
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"fmt"
+	"moneropot/util"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Price is a quote of one source on a date, the chosen row is the median the entry price was set from
+	Price struct {
+		ID         int64   `json:"id" db:"id"`
+		Date       string  `json:"date" db:"date"`
+		Source     string  `json:"source" db:"source"`
+		XmrRate    uint64  `json:"xmr_rate" db:"xmr_rate"`
+		Currency   string  `json:"currency" db:"currency"`
+		EntryPrice uint64  `json:"entry_price" db:"entry_price"`
+		Error      *string `json:"error" db:"error"`
+		Outlier    bool    `json:"outlier" db:"outlier"`
+		CreatedAt  int64   `json:"created_at" db:"created_at"`
+	}
+
+	// EntryPrice is the entry price from ValidFrom until the next one, transfers are credited
+	// at the price valid when they were sent
+	EntryPrice struct {
+		ID        int64  `json:"id" db:"id"`
+		Price     uint64 `json:"price" db:"price"`
+		Currency  string `json:"currency" db:"currency"`
+		ValidFrom int64  `json:"valid_from" db:"valid_from"`
+	}
+)
+
+const (
+	PriceChosen = "chosen"
+
+	currentPriceKey = "current_price"
+)
+
+// savePrices keeps the quotes of every source, and the chosen price when there is one
+func savePrices(date string, currency string, quotes []util.Quote, xmrRate uint64, entryPrice uint64) error {
+	tx, err := MustDB().Begin()
+	if err != nil {
+		return fmt.Errorf("savePrices begin error %v", err)
+	}
+	now := util.UtcNow().Unix()
+	for _, q := range quotes {
+		var qerr *string
+		if q.Error != "" {
+			qerr = &q.Error
+		}
+		if _, err := tx.Exec(`INSERT INTO prices (date, source, xmr_rate, currency, error, outlier, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`, date, q.Source, q.Price, currency, qerr, q.Outlier, now); err != nil {
+			return fmt.Errorf("savePrices insert error %v rollback: %v", err, tx.Rollback())
+		}
+	}
+	if entryPrice > 0 {
+		if _, err := tx.Exec(`INSERT INTO prices (date, source, xmr_rate, currency, entry_price, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`, date, PriceChosen, xmrRate, currency, entryPrice, now); err != nil {
+			return fmt.Errorf("savePrices insert chosen error %v rollback: %v", err, tx.Rollback())
+		}
+	}
+	return tx.Commit()
+}
+
+// LastPrice is the latest chosen price, nil when the price was never set from the sources
+func LastPrice() (*Price, error) {
+	p := &Price{}
+	if err := MustDB().Get(p, `SELECT * FROM prices WHERE source = $1 ORDER BY id DESC LIMIT 1`, PriceChosen); err != nil {
+		if util.NoRows(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("LastPrice error %v", err)
+	}
+	return p, nil
+}
+
+// GetPrices lists the quotes of a date, or the latest ones without a date
+func GetPrices(date string, page int) ([]Price, error) {
+	db := MustDB()
+	prices := []Price{}
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * 50
+	var err error
+	if date == "" {
+		err = db.Select(&prices, `SELECT * FROM prices ORDER BY id DESC LIMIT 50 OFFSET $1`, offset)
+	} else {
+		err = db.Select(&prices, `SELECT * FROM prices WHERE date = $1 ORDER BY id DESC LIMIT 50 OFFSET $2`, date, offset)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetPrices error %v", err)
+	}
+	return prices, nil
+}
+
+// GetEntryPrices is the history of the entry price, oldest first
+func GetEntryPrices() ([]EntryPrice, error) {
+	prices := []EntryPrice{}
+	if err := MustDB().Select(&prices, `SELECT * FROM entry_prices ORDER BY valid_from, id`); err != nil {
+		return nil, fmt.Errorf("GetEntryPrices error %v", err)
+	}
+	return prices, nil
+}
+
+// recordEntryPrice adds the price to the history when it changed, the first one is valid
+// from the start so transfers before it was kept get it too
+func recordEntryPrice(price uint64, currency string) error {
+	last := &EntryPrice{}
+	err := MustDB().Get(last, `SELECT * FROM entry_prices ORDER BY valid_from DESC, id DESC LIMIT 1`)
+	if err != nil && !util.NoRows(err) {
+		return fmt.Errorf("recordEntryPrice error %v", err)
+	}
+	if err == nil && last.Price == price && last.Currency == currency {
+		return nil
+	}
+	var validFrom int64
+	if err == nil {
+		validFrom = util.UtcNow().Unix()
+	}
+	if _, err := MustDB().Exec(`INSERT INTO entry_prices (price, currency, valid_from) VALUES ($1, $2, $3)`,
+		price, currency, validFrom); err != nil {
+		return fmt.Errorf("recordEntryPrice insert error %v", err)
+	}
+	return nil
+}
+
+// priceAt is the lowest entry price valid between grace before the block timestamp and the
+// timestamp, the block comes after the transfer was sent, CurrentPrice without a timestamp
+func priceAt(history []EntryPrice, timestamp uint64) uint64 {
+	if timestamp == 0 || len(history) == 0 {
+		return CurrentPrice
+	}
+	to := int64(timestamp)
+	from := to - int64(util.Config.PriceGrace.Seconds())
+	var price uint64
+	for i, p := range history {
+		if i > 0 && p.ValidFrom > to {
+			break
+		}
+		if i+1 < len(history) && history[i+1].ValidFrom <= from {
+			continue
+		}
+		if price == 0 || p.Price < price {
+			price = p.Price
+		}
+	}
+	return price
+}
+
+// SetCurrentPrice loads today's entry price or sets it from the price sources, when none of them
+// can be used the last known price is kept and the price job retries
+func SetCurrentPrice() error {
+	err := updateCurrentPrice()
+	if err == nil {
+		return nil
+	}
+	if CurrentPrice == 0 {
+		price, merr := GetMetadata(currentPriceKey, "")
+		if merr != nil {
+			return fmt.Errorf("SetCurrentPrice error %v", merr)
+		}
+		_, CurrentPrice, _ = parseCurrentPrice(price)
+		if last, lerr := LastPrice(); lerr == nil && last != nil && last.Currency == util.FiatCurrency() {
+			util.SetXmrPrice(last.XmrRate)
+		}
+	}
+	if CurrentPrice == 0 {
+		return fmt.Errorf("%v, no price to fall back to, see -price-static", err)
+	}
+	priceLog.Warn("using last known price", "price", CurrentPrice, "error", err)
+	return nil
+}
+
+// updateCurrentPrice sets today's price from the sources, a fixed entry price is only set
+func updateCurrentPrice() error {
+	if util.FixedPrice() {
+		if CurrentPrice != util.Config.EntryPiconero {
+			CurrentPrice = util.Config.EntryPiconero
+			refreshAllInfo()
+			priceLog.Info("fixed price", "price", CurrentPrice)
+		}
+		return recordEntryPrice(CurrentPrice, "XMR")
+	}
+	price, err := GetMetadata(currentPriceKey, "")
+	if err != nil {
+		return fmt.Errorf("SetCurrentPrice error %v", err)
+	}
+	dt := util.UtcNow().Format(DateFormat)
+	currency := util.FiatCurrency()
+	if date, entryPrice, priceCurrency := parseCurrentPrice(price); date == dt && priceCurrency == currency {
+		CurrentPrice = entryPrice
+		priceLog.Info("loaded price", "price", CurrentPrice, "currency", currency)
+		return recordEntryPrice(CurrentPrice, currency)
+	}
+	// price is outdated or in another currency need to update
+	xmrPrice, quotes, ferr := util.FetchPrice()
+	for _, q := range quotes {
+		if q.Error != "" {
+			priceLog.Warn("price source failed", "source", q.Source, "error", q.Error)
+		} else if q.Outlier {
+			priceLog.Warn("price source outlier", "source", q.Source, "xmr_rate", util.FiatToDecimal(q.Price), "currency", currency)
+		}
+	}
+	var newPrice uint64
+	if ferr == nil {
+		newPrice = util.CalcEntryFromFiat(util.Config.TicketPrice, xmrPrice)
+	}
+	if err := savePrices(dt, currency, quotes, xmrPrice, newPrice); err != nil {
+		return fmt.Errorf("SetCurrentPrice error %v", err)
+	}
+	if ferr != nil {
+		return fmt.Errorf("SetCurrentPrice error %v", ferr)
+	}
+	if err := SetMetadata(currentPriceKey, dt+":"+strconv.FormatUint(newPrice, 10)+":"+currency); err != nil {
+		return fmt.Errorf("SetCurrentPrice error %v", err)
+	}
+	CurrentPrice = newPrice
+	refreshAllInfo()
+	priceLog.Info("updated price", "price", CurrentPrice, "xmr_rate", util.FiatToDecimal(xmrPrice), "currency", currency)
+	return recordEntryPrice(CurrentPrice, currency)
+}
+
+// parseCurrentPrice splits date:entry price:currency, prices before the currency was kept are USD
+func parseCurrentPrice(value string) (string, uint64, string) {
+	p := strings.Split(value, ":")
+	if len(p) < 2 {
+		return "", 0, ""
+	}
+	price, _ := strconv.ParseUint(p[1], 10, 64)
+	currency := "USD"
+	if len(p) > 2 {
+		currency = p[2]
+	}
+	return p[0], price, currency
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"fmt"
+	"moneropot/util"
+	"testing"
+	"time"
+)
+
+type testPriceSource struct {
+	name  string
+	price uint64
+	err   error
+}
+
+func (s testPriceSource) Name() string {
+	return s.name
+}
+
+func (s testPriceSource) XmrRate(currency string) (uint64, error) {
+	return s.price, s.err
+}
+
+func TestSetCurrentPrice(t *testing.T) {
+	now, sources, current, currency := util.Now, util.Prices, CurrentPrice, util.Config.Currency
+	defer func() {
+		util.Now, util.Prices, CurrentPrice, util.Config.Currency = now, sources, current, currency
+	}()
+	util.Now = func() time.Time {
+		return time.Date(2021, 12, 2, 3, 0, 0, 0, time.UTC)
+	}
+	util.Prices = []util.PriceSource{
+		testPriceSource{"a", 200e8, nil},
+		testPriceSource{"b", 204e8, nil},
+		testPriceSource{"c", 400e8, nil},
+		testPriceSource{"d", 0, fmt.Errorf("down")},
+	}
+	if err := SetCurrentPrice(); err != nil {
+		t.Fatalf("Wanted no error got %v", err)
+	}
+	// c is left out so the median is between a and b
+	if want := util.CalcEntryFromFiat(util.Config.TicketPrice, 202e8); CurrentPrice != want {
+		t.Errorf("Wanted price %d got %d", want, CurrentPrice)
+	}
+	prices, err := GetPrices("2021-12-02", 1)
+	if err != nil || len(prices) != 5 {
+		t.Fatalf("Wanted 5 prices got %v %v", prices, err)
+	}
+	if p := prices[0]; p.Source != PriceChosen || p.XmrRate != 202e8 || p.EntryPrice != CurrentPrice {
+		t.Errorf("Wanted chosen price got %+v", p)
+	}
+	for _, p := range prices[1:] {
+		if outlier := p.Source == "c"; p.Outlier != outlier {
+			t.Errorf("Wanted %s outlier %v got %v", p.Source, outlier, p.Outlier)
+		}
+		if failed := p.Source == "d"; (p.Error != nil) != failed {
+			t.Errorf("Wanted %s error %v got %v", p.Source, failed, p.Error)
+		}
+	}
+
+	// every source down the next day keeps the last price
+	util.Now = func() time.Time {
+		return time.Date(2021, 12, 3, 3, 0, 0, 0, time.UTC)
+	}
+	util.Prices = []util.PriceSource{testPriceSource{"d", 0, fmt.Errorf("down")}}
+	last := CurrentPrice
+	if err := updateCurrentPrice(); err == nil {
+		t.Errorf("Wanted error for the price job to retry")
+	}
+	CurrentPrice = 0
+	if err := SetCurrentPrice(); err != nil || CurrentPrice != last {
+		t.Errorf("Wanted last price %d got %d %v", last, CurrentPrice, err)
+	}
+	if prices, _ := GetPrices("2021-12-03", 1); len(prices) != 2 || prices[0].Error == nil {
+		t.Errorf("Wanted failed quotes kept got %v", prices)
+	}
+	if p, err := LastPrice(); err != nil || p.Date != "2021-12-02" {
+		t.Errorf("Wanted last chosen price of 2021-12-02 got %v %v", p, err)
+	}
+
+	// the same day in another currency is priced again
+	util.Config.Currency = "EUR"
+	util.Prices = []util.PriceSource{testPriceSource{"a", 180e8, nil}}
+	if err := updateCurrentPrice(); err != nil {
+		t.Fatalf("Wanted no error got %v", err)
+	}
+	price, _ := GetMetadata(currentPriceKey, "")
+	if date, entryPrice, currency := parseCurrentPrice(price); date != "2021-12-03" || currency != "EUR" ||
+		entryPrice != util.CalcEntryFromFiat(util.Config.TicketPrice, 180e8) || entryPrice != CurrentPrice {
+		t.Errorf("Wanted EUR price got %s", price)
+	}
+	if p, _ := LastPrice(); p.Currency != "EUR" || p.XmrRate != 180e8 {
+		t.Errorf("Wanted last price in EUR got %+v", p)
+	}
+}
+
+func TestParseCurrentPrice(t *testing.T) {
+	tests := []struct {
+		value    string
+		date     string
+		price    uint64
+		currency string
+	}{
+		{"2021-11-20:1000", "2021-11-20", 1000, "USD"},
+		{"2021-11-20:1000:EUR", "2021-11-20", 1000, "EUR"},
+		{"", "", 0, ""},
+	}
+	for _, tt := range tests {
+		date, price, currency := parseCurrentPrice(tt.value)
+		if date != tt.date || price != tt.price || currency != tt.currency {
+			t.Errorf("%q wanted %s %d %s got %s %d %s", tt.value, tt.date, tt.price, tt.currency, date, price, currency)
+		}
+	}
+}
+
+func TestFixedPrice(t *testing.T) {
+	sources, current, fixed := util.Prices, CurrentPrice, util.Config.EntryPiconero
+	defer func() {
+		util.Prices, CurrentPrice, util.Config.EntryPiconero = sources, current, fixed
+	}()
+	util.Config.EntryPiconero = 5e9
+	util.Prices = []util.PriceSource{testPriceSource{"a", 0, fmt.Errorf("asked")}}
+	before, _ := GetPrices("", 1)
+	SetMetadata(currentPriceKey, "2021-01-01:1000")
+	if err := SetCurrentPrice(); err != nil || CurrentPrice != 5e9 {
+		t.Errorf("Wanted fixed price got %d %v", CurrentPrice, err)
+	}
+	if err := priceUpdate(); err != nil {
+		t.Errorf("Wanted no error got %v", err)
+	}
+	if after, _ := GetPrices("", 1); len(after) != len(before) {
+		t.Errorf("Wanted no quotes saved got %d", len(after)-len(before))
+	}
+	if _, _, err := util.FetchPrice(); err != util.ErrFixedPrice {
+		t.Errorf("Wanted ErrFixedPrice got %v", err)
+	}
+	if h := CheckHealth(true); h.Checks["price"].Status != HealthOK {
+		t.Errorf("Wanted fixed price healthy got %v", h.Checks["price"])
+	}
+}
+
+func TestPriceAt(t *testing.T) {
+	grace, current := util.Config.PriceGrace, CurrentPrice
+	defer func() {
+		util.Config.PriceGrace, CurrentPrice = grace, current
+	}()
+	util.Config.PriceGrace = time.Minute * 20
+	CurrentPrice = 7
+	history := []EntryPrice{{Price: 10, ValidFrom: 0}, {Price: 8, ValidFrom: 1000}, {Price: 12, ValidFrom: 5000}}
+	var tests = []struct {
+		history   []EntryPrice
+		timestamp uint64
+		price     uint64
+	}{
+		{history, 0, 7},
+		{nil, 3000, 7},
+		{history, 500, 10},
+		{history, 1000, 8},
+		{history, 3000, 8},
+		{history, 5000, 8},
+		{history, 6199, 8},
+		{history, 6200, 12},
+		{history[:1], 9000, 10},
+	}
+	for _, tt := range tests {
+		if price := priceAt(tt.history, tt.timestamp); price != tt.price {
+			t.Errorf("%d wanted price %d got %d", tt.timestamp, tt.price, price)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"moneropot/util"
+)
+
+type (
+	// Schedule is a parsed cron expression: minute hour day-of-month month day-of-week
+	Schedule struct {
+		minute uint64
+		hour   uint64
+		dom    uint64
+		month  uint64
+		dow    uint64
+		anyDom bool
+		anyDow bool
+	}
+
+	cronJob struct {
+		name     string
+		schedule *Schedule
+		run      func(at time.Time) error
+		next     time.Time
+		timer    *time.Timer
+	}
+)
+
+const (
+	CronPrice           = "price"
+	CronMissedTransfers = "missed_transfers"
+	CronBackup          = "backup"
+	CronPayouts         = "payouts"
+)
+
+var (
+	scheduleAliases = map[string]string{
+		ScheduleMonthly: "5 0 1 * *",
+		ScheduleWeekly:  "5 0 * * 1",
+		"@monthly":      "0 0 1 * *",
+		"@weekly":       "0 0 * * 0",
+		"@daily":        "0 0 * * *",
+		"@hourly":       "0 * * * *",
+	}
+	cronJobs = make(map[string]*cronJob)
+	cronLock sync.Mutex
+)
+
+// ParseSchedule parses a 5 field cron expression supporting *, lists, ranges and steps,
+// monthly and weekly are the pot draw schedules
+func ParseSchedule(expr string) (*Schedule, error) {
+	if alias, ok := scheduleAliases[expr]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("ParseSchedule %q expected 5 fields", expr)
+	}
+	s := &Schedule{
+		anyDom: strings.HasPrefix(fields[2], "*"),
+		anyDow: strings.HasPrefix(fields[4], "*"),
+	}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	targets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		bits, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("ParseSchedule %q error %v", expr, err)
+		}
+		*targets[i] = bits
+	}
+	// sunday is either 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %s", part)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			var err error
+			if i := strings.Index(part, "-"); i >= 0 {
+				if lo, err = strconv.Atoi(part[:i]); err == nil {
+					hi, err = strconv.Atoi(part[i+1:])
+				}
+			} else if lo, err = strconv.Atoi(part); err == nil && step == 1 {
+				hi = lo
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %s", part)
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%s out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t matching the schedule
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// something like 31st of february never matches
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron, when both day fields are restricted either one matching is enough
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func nextRunKey(name string) string {
+	return "next_run:" + name
+}
+
+// ScheduleCron runs the job on the cron expression, the next run is kept in metadata so a run
+// missed while the server was down happens on start and a finished run isn't repeated
+func ScheduleCron(name string, expr string, run func(at time.Time) error) error {
+	sched, err := ParseSchedule(expr)
+	if err != nil {
+		return err
+	}
+	next := sched.Next(util.UtcNow())
+	saved, err := GetMetadata(nextRunKey(name), "")
+	if err != nil {
+		return fmt.Errorf("ScheduleCron error %v", err)
+	}
+	if saved != "" {
+		if t, err := time.Parse(time.RFC3339, saved); err == nil && t.Before(util.UtcNow()) {
+			cronLog.Warn("missed run", "job", name, "at", saved)
+			next = t
+		}
+	}
+	if err := SetMetadata(nextRunKey(name), next.Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("ScheduleCron error %v", err)
+	}
+	j := &cronJob{
+		name:     name,
+		schedule: sched,
+		run:      run,
+	}
+	cronLock.Lock()
+	defer cronLock.Unlock()
+	if old, ok := cronJobs[name]; ok {
+		old.timer.Stop()
+	}
+	cronJobs[name] = j
+	j.arm(next)
+	return nil
+}
+
+// arm needs cronLock
+func (j *cronJob) arm(next time.Time) {
+	j.next = next
+	j.timer = time.AfterFunc(next.Sub(util.UtcNow()), func() {
+		runCronJob(j, next)
+	})
+}
+
+func runCronJob(j *cronJob, at time.Time) {
+	if err := j.run(at); err != nil {
+		cronLog.Error("run failed", "job", j.name, "error", err)
+		// the stored next run stays in the past so a restart retries as well
+		cronLock.Lock()
+		if cronJobs[j.name] == j {
+			j.timer = time.AfterFunc(time.Minute*1, func() {
+				runCronJob(j, at)
+			})
+		}
+		cronLock.Unlock()
+		return
+	}
+	next := j.schedule.Next(util.UtcNow())
+	if err := SetMetadata(nextRunKey(j.name), next.Format(time.RFC3339)); err != nil {
+		cronLog.Error("save next run failed", "job", j.name, "error", err)
+	}
+	cronLock.Lock()
+	if cronJobs[j.name] == j {
+		j.arm(next)
+	}
+	cronLock.Unlock()
+}
+
+// RunCronJob runs a scheduled job now then waits for its next run
+func RunCronJob(name string) error {
+	cronLock.Lock()
+	j, ok := cronJobs[name]
+	if ok {
+		j.timer.Stop()
+	}
+	cronLock.Unlock()
+	if !ok {
+		return fmt.Errorf("RunCronJob unknown job %s", name)
+	}
+	runCronJob(j, util.UtcNow())
+	return nil
+}
+
+// NextRun is when the job runs next, zero if it isn't scheduled
+func NextRun(name string) time.Time {
+	cronLock.Lock()
+	defer cronLock.Unlock()
+	if j, ok := cronJobs[name]; ok {
+		return j.next
+	}
+	return time.Time{}
+}
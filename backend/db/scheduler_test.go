@@ -0,0 +1,43 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	now := time.Date(2021, 11, 20, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{ScheduleMonthly, time.Date(2021, 12, 1, 0, 5, 0, 0, time.UTC)},
+		{ScheduleWeekly, time.Date(2021, 11, 22, 0, 5, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2021, 11, 21, 3, 0, 0, 0, time.UTC)},
+		{"30 23 * * *", time.Date(2021, 11, 20, 23, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, 11, 20, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2021, 11, 20, 13, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 11, 21, 0, 0, 0, 0, time.UTC)},
+		// either day field matches when both are set
+		{"0 0 25 * 1", time.Date(2021, 11, 22, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%s wanted no error got %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(now); !got.Equal(tt.want) {
+			t.Errorf("%s wanted %v got %v", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("%q wanted error", expr)
+		}
+	}
+}
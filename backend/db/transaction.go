@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"moneropot/monerorpc"
+	"moneropot/util"
+)
+
+const (
+	TransactionScan   = "scan"
+	TransactionMissed = "missed"
+)
+
+type (
+	// Transaction is an incoming payment as the wallet reported it, with the entry price it
+	// was credited at and the entries it bought, transfers to no active account have no
+	// account id. A tx paying several subaddresses is a row for each, rows from before the
+	// ledger only have the txid
+	Transaction struct {
+		ID           string  `json:"txid" db:"id"`
+		PotID        int64   `json:"-" db:"pot_id"`
+		AccountID    int64   `json:"-" db:"account_id"`
+		AccountIndex uint64  `json:"-" db:"account_index"`
+		AddressIndex uint64  `json:"-" db:"address_index"`
+		Amount       uint64  `json:"amount" db:"amount"`
+		Height       uint64  `json:"height" db:"height"`
+		Timestamp    uint64  `json:"timestamp" db:"timestamp"`
+		Price        uint64  `json:"price" db:"price"`
+		Entries      int64   `json:"entries" db:"entries"`
+		Source       string  `json:"-" db:"source"`
+		CreatedAt    int64   `json:"created_at" db:"created_at"`
+		EntryIDs     []int64 `json:"entry_ids" db:"-"`
+	}
+)
+
+// recordTransaction adds the transfer to the ledger, price and entries are set once its entries are created
+func recordTransaction(tx *sql.Tx, t monerorpc.Transfer, account *Account, source string) error {
+	var potID, accountID int64
+	if account != nil {
+		potID, accountID = account.PotID, account.ID
+	}
+	_, err := tx.Exec(`INSERT INTO transactions (id, pot_id, account_id, account_index, address_index, amount, height, timestamp, source, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`, t.Txid, potID, accountID, t.SubaddrIndex.Major, t.SubaddrIndex.Minor,
+		t.Amount, t.Height, t.Timestamp, source, util.UtcNow().Unix())
+	if err != nil {
+		return fmt.Errorf("recordTransaction error %v", err)
+	}
+	return nil
+}
+
+// GetTransactions is the payment history of an account, newest first, address is the account's
+// deposit address so only the one who got it can look it up
+func GetTransactions(potID int64, accountID int64, address string, page int) ([]Transaction, error) {
+	db := MustDB()
+	if page < 1 {
+		page = 1
+	}
+	limit := 100
+	txs := []Transaction{}
+	if err := db.Select(&txs, fmt.Sprintf(`SELECT t.* FROM transactions t JOIN accounts a ON a.id = t.account_id
+		WHERE t.pot_id = $1 AND t.account_id = $2 AND a.address = $3
+		ORDER BY t.height DESC, t.created_at DESC LIMIT %d OFFSET %d`, limit, (page-1)*limit), potID, accountID, address); err != nil {
+		return nil, fmt.Errorf("GetTransactions error %v", err)
+	}
+	if len(txs) == 0 {
+		return txs, nil
+	}
+	var entries []Entry
+	if err := db.Select(&entries, `SELECT * FROM entries WHERE pot_id = $1 AND account_id = $2 AND tx_id != '' ORDER BY id`,
+		potID, accountID); err != nil {
+		return nil, fmt.Errorf("GetTransactions entries error %v", err)
+	}
+	txEntries := make(map[string][]int64)
+	for _, e := range entries {
+		txEntries[e.TxID] = append(txEntries[e.TxID], e.ID)
+	}
+	for i := range txs {
+		txs[i].EntryIDs = txEntries[txs[i].ID]
+		if txs[i].EntryIDs == nil {
+			txs[i].EntryIDs = []int64{}
+		}
+	}
+	return txs, nil
+}
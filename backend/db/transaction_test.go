@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"moneropot/monerorpc"
+	"moneropot/util"
+	"testing"
+)
+
+func TestTransactionLedger(t *testing.T) {
+	pot, err := GetPot(DefaultPotID)
+	if err != nil {
+		t.Fatalf("get pot error %v", err)
+	}
+	acct, err := GetAccount(context.Background(), pot, util.RandomString(95), nil, nil)
+	if err != nil {
+		t.Fatalf("get account error %v", err)
+	}
+	other, err := GetAccount(context.Background(), pot, util.RandomString(95), nil, nil)
+	if err != nil {
+		t.Fatalf("get account error %v", err)
+	}
+	h, err := LastHeight()
+	if err != nil {
+		t.Fatalf("last height error %v", err)
+	}
+	index := monerorpc.SubaddressIndex{Major: pot.AccountIndex, Minor: acct.AddressIndex}
+	first, second, unknown := util.RandomString(64), util.RandomString(64), util.RandomString(64)
+	// the second tx also pays another account, each is its own transfer
+	// the second payment buys an entry with what's left of the first
+	fakeRPC.AddIncoming(monerorpc.Transfer{Txid: first, Amount: CurrentPrice + CurrentPrice/2, Height: h + 1, SubaddrIndex: index})
+	fakeRPC.AddIncoming(monerorpc.Transfer{Txid: second, Amount: CurrentPrice / 2, Height: h + 2, SubaddrIndex: index})
+	fakeRPC.AddIncoming(monerorpc.Transfer{Txid: second, Amount: CurrentPrice, Height: h + 2,
+		SubaddrIndex: monerorpc.SubaddressIndex{Major: pot.AccountIndex, Minor: other.AddressIndex}})
+	fakeRPC.AddIncoming(monerorpc.Transfer{Txid: unknown, Amount: 10, Height: h + 2,
+		SubaddrIndex: monerorpc.SubaddressIndex{Major: pot.AccountIndex, Minor: 1 << 20}})
+	checkTransfers()
+
+	txs, err := GetTransactions(pot.ID, acct.ID, acct.Address, 1)
+	if err != nil {
+		t.Fatalf("get transactions error %v", err)
+	}
+	if len(txs) != 2 {
+		t.Fatalf("Wanted 2 transactions got %d", len(txs))
+	}
+	var tests = []struct {
+		txid   string
+		amount uint64
+		height uint64
+		count  int
+	}{
+		{second, CurrentPrice / 2, h + 2, 1},
+		{first, CurrentPrice + CurrentPrice/2, h + 1, 1},
+	}
+	for i, tt := range tests {
+		tx := txs[i]
+		if tx.ID != tt.txid || tx.Amount != tt.amount || tx.Height != tt.height || tx.Source != TransactionScan {
+			t.Errorf("Wanted %s %d at %d got %s %d at %d %s", tt.txid, tt.amount, tt.height, tx.ID, tx.Amount, tx.Height, tx.Source)
+		}
+		if tx.Price != CurrentPrice || tx.Entries != int64(tt.count) || len(tx.EntryIDs) != tt.count {
+			t.Errorf("%s wanted %d entries at %d got %d %v at %d", tx.ID, tt.count, CurrentPrice, tx.Entries, tx.EntryIDs, tx.Price)
+		}
+	}
+	txs, err = GetTransactions(pot.ID, other.ID, other.Address, 1)
+	if err != nil {
+		t.Fatalf("get transactions error %v", err)
+	}
+	if len(txs) != 1 || txs[0].ID != second || txs[0].Amount != CurrentPrice || txs[0].Entries != 1 || len(txs[0].EntryIDs) != 1 {
+		t.Errorf("Wanted %s with 1 entry for the other account got %+v", second, txs)
+	}
+	if txs, err := GetTransactions(pot.ID, acct.ID, util.RandomString(95), 1); err != nil || len(txs) != 0 {
+		t.Errorf("Wanted no transactions for another address got %d %v", len(txs), err)
+	}
+	var accountID int64
+	if err := dbx.Get(&accountID, `SELECT account_id FROM transactions WHERE id = $1`, unknown); err != nil || accountID != 0 {
+		t.Errorf("Wanted transfer to no account recorded got %d %v", accountID, err)
+	}
+}
@@ -1,26 +1,15 @@
 package db
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"sync"
 	"time"
 
 	"moneropot/monerorpc"
-	"moneropot/util"
 )
 
-var (
-	Wallet     *monerorpc.Client
-	Daemon     *monerorpc.Client
-	walletLock sync.Mutex
-	daemonLock sync.Mutex
-)
-
-func IsValidAddress(address string) error {
-	walletLock.Lock()
-	r, err := Wallet.ValidateAddress(&monerorpc.ValidateAddressRequest{Address: address})
-	walletLock.Unlock()
+func IsValidAddress(ctx context.Context, address string) error {
+	r, err := walletFor(ctx).ValidateAddress(&monerorpc.ValidateAddressRequest{Address: address})
 	if err != nil {
 		return err
 	}
@@ -30,10 +19,9 @@ func IsValidAddress(address string) error {
 	return fmt.Errorf("invalid address")
 }
 
-func GetWalletAddress() (string, error) {
-	walletLock.Lock()
-	r, err := Wallet.GetAddress(&monerorpc.GetAddressRequest{AddressIndex: []uint64{0}})
-	walletLock.Unlock()
+// GetWalletAddress returns the main address of the pot's wallet account
+func GetWalletAddress(ctx context.Context, accountIndex uint64) (string, error) {
+	r, err := walletFor(ctx).GetAddress(&monerorpc.GetAddressRequest{AccountIndex: accountIndex, AddressIndex: []uint64{0}})
 	if err != nil {
 		return "", err
 	}
@@ -41,15 +29,20 @@ func GetWalletAddress() (string, error) {
 }
 
 func GetFirstBlockOfMonth(tm time.Time) (string, error) {
-	daemonLock.Lock()
-	defer daemonLock.Unlock()
+	return GetFirstBlockAfter(time.Date(tm.Year(), tm.Month(), 1, 0, 0, 0, 0, time.UTC))
+}
+
+// GetFirstBlockAfter finds the first block mined at or after month, the start of a draw period
+func GetFirstBlockAfter(month time.Time) (string, error) {
+	return firstBlockAfter(Daemon, month)
+}
 
-	bh, err := Daemon.GetLastBlockHeader()
+func firstBlockAfter(chain ChainBackend, month time.Time) (string, error) {
+	bh, err := chain.GetLastBlockHeader()
 	if err != nil {
 		return "", fmt.Errorf("first block error %v", err)
 	}
 	latestBlockTime := time.Unix(int64(bh.BlockHeader.Timestamp), 0)
-	month := time.Date(tm.Year(), tm.Month(), 1, 0, 0, 0, 0, time.UTC)
 	beforeMonth := month.Add(-1 * time.Microsecond)
 	if latestBlockTime.Before(month) {
 		return "", fmt.Errorf("first block for month not yet created")
@@ -78,7 +71,7 @@ func GetFirstBlockOfMonth(tm time.Time) (string, error) {
 		if e > bh.BlockHeader.Height {
 			e = bh.BlockHeader.Height
 		}
-		br, err := Daemon.GetBlockHeadersRange(&monerorpc.GetBlockHeadersRangeRequest{
+		br, err := chain.GetBlockHeadersRange(&monerorpc.GetBlockHeadersRangeRequest{
 			StartHeight: s,
 			EndHeight:   e,
 		})
@@ -90,9 +83,7 @@ func GetFirstBlockOfMonth(tm time.Time) (string, error) {
 			if t.Before(month) {
 				foundBeforeMonth = true
 			} else if foundBeforeMonth && t.After(beforeMonth) {
-				if !util.Config.Production {
-					log.Println("Block", h)
-				}
+				daemonLog.Debug("first block", "month", month.Format(DateFormat), "height", h.Height, "hash", h.Hash)
 				foundBlock = h.Hash
 				break
 			}
@@ -1,36 +1,159 @@
 package db
 
 import (
+	"context"
 	"moneropot/monerorpc"
 	"moneropot/util"
-	"os"
 	"testing"
-
-	"github.com/gabstv/httpdigest"
+	"time"
 )
 
 func TestFirstBlockOfMonth(t *testing.T) {
-	cfg := monerorpc.Config{
-		Address:   "http://localhost:28081/json_rpc",
-		Transport: httpdigest.New(util.Config.DaemonUser, util.Config.DaemonPass),
+	month := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	want, err := fakeRPC.Client().GetBlock(&monerorpc.GetBlockRequest{Height: fakeRPC.HeightAt(uint64(month.Unix()))})
+	if err != nil {
+		t.Fatalf("get block error %v", err)
+	}
+	block, err := GetFirstBlockOfMonth(month.AddDate(0, 0, 10))
+	if err != nil {
+		t.Errorf("first block error %v", err)
+	}
+	if block != want.BlockHeader.Hash {
+		t.Errorf("Wanted block %d %s got %s", want.BlockHeader.Height, want.BlockHeader.Hash, block)
+	}
+	if _, err := GetFirstBlockOfMonth(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Errorf("Wanted error for a month not mined yet")
 	}
-	Daemon = monerorpc.New(cfg)
-
-	// block, err := GetFirstBlockOfMonth(time.Date(2021, 12, 1, 0, 5, 0, 0, time.UTC))
-	// t.Errorf("Block %s -> %v", block, err)
 }
 
 func TestGetTransfers(t *testing.T) {
-	os.Setenv("DB_NAME", ":memory:")
-	util.ParseArgs()
-	Init()
-	cfg := monerorpc.Config{
-		Address:   "http://localhost:28081/json_rpc",
-		Transport: httpdigest.New(util.Config.RpcUser, util.Config.RpcPass),
-	}
-	Wallet = monerorpc.New(cfg)
-	// if err := CheckMissedTransfers(); err != nil {
-	// 	t.Fatalf("Err checkmissedTransfers %v", err)
-	// }
-	// t.Errorf("TEST")
+	pot, err := GetPot(DefaultPotID)
+	if err != nil {
+		t.Fatalf("get pot error %v", err)
+	}
+	acct, err := GetAccount(context.Background(), pot, util.RandomString(95), nil, nil)
+	if err != nil {
+		t.Fatalf("get account error %v", err)
+	}
+	h, err := LastHeight()
+	if err != nil {
+		t.Fatalf("last height error %v", err)
+	}
+	txid := util.RandomString(64)
+	fakeRPC.AddIncoming(monerorpc.Transfer{
+		Txid:         txid,
+		Amount:       CurrentPrice * 2,
+		Height:       h + 1,
+		SubaddrIndex: monerorpc.SubaddressIndex{Major: pot.AccountIndex, Minor: acct.AddressIndex},
+	})
+	checkTransfers()
+	var count int64
+	if err := dbx.Get(&count, `SELECT COUNT(*) FROM transactions WHERE id = $1`, txid); err != nil || count != 1 {
+		t.Errorf("Wanted transaction %s recorded got %d %v", txid, count, err)
+	}
+	if err := dbx.Get(&count, `SELECT COUNT(*) FROM entries WHERE account_id = $1`, acct.ID); err != nil || count != 2 {
+		t.Errorf("Wanted 2 entries got %d %v", count, err)
+	}
+	if nh, _ := LastHeight(); nh != h+1 {
+		t.Errorf("Wanted height %d got %d", h+1, nh)
+	}
+	// already scanned transfers aren't counted twice
+	checkTransfers()
+	if err := dbx.Get(&count, `SELECT COUNT(*) FROM entries WHERE account_id = $1`, acct.ID); err != nil || count != 2 {
+		t.Errorf("Wanted still 2 entries got %d %v", count, err)
+	}
+}
+
+func TestTransferPriceAtTimestamp(t *testing.T) {
+	grace := util.Config.PriceGrace
+	defer func() {
+		util.Config.PriceGrace = grace
+		dbx.Exec(`DELETE FROM entry_prices WHERE valid_from >= 2000000000`)
+	}()
+	util.Config.PriceGrace = 0
+	// the price doubled after the transfer was sent, it still buys at the old one
+	if _, err := dbx.Exec(`INSERT INTO entry_prices (price, currency, valid_from) VALUES ($1, 'USD', 2000000000), ($2, 'USD', 2000003600)`,
+		CurrentPrice, CurrentPrice*2); err != nil {
+		t.Fatalf("insert entry prices error %v", err)
+	}
+	pot, err := GetPot(DefaultPotID)
+	if err != nil {
+		t.Fatalf("get pot error %v", err)
+	}
+	acct, err := GetAccount(context.Background(), pot, util.RandomString(95), nil, nil)
+	if err != nil {
+		t.Fatalf("get account error %v", err)
+	}
+	h, err := LastHeight()
+	if err != nil {
+		t.Fatalf("last height error %v", err)
+	}
+	fakeRPC.AddIncoming(monerorpc.Transfer{
+		Txid:         util.RandomString(64),
+		Amount:       CurrentPrice * 2,
+		Height:       h + 1,
+		Timestamp:    2000001800,
+		SubaddrIndex: monerorpc.SubaddressIndex{Major: pot.AccountIndex, Minor: acct.AddressIndex},
+	})
+	checkTransfers()
+	var count int64
+	if err := dbx.Get(&count, `SELECT COUNT(*) FROM entries WHERE account_id = $1`, acct.ID); err != nil || count != 2 {
+		t.Errorf("Wanted 2 entries at the old price got %d %v", count, err)
+	}
+}
+
+func TestGetTransfersInactivePot(t *testing.T) {
+	pot, err := CreatePot("inactive", "weekly")
+	if err != nil {
+		t.Fatalf("create pot error %v", err)
+	}
+	acct, err := GetAccount(context.Background(), pot, util.RandomString(95), nil, nil)
+	if err != nil {
+		t.Fatalf("get account error %v", err)
+	}
+	if _, err := dbx.Exec(`UPDATE pots SET active = 0 WHERE id = $1`, pot.ID); err != nil {
+		t.Fatalf("deactivate pot error %v", err)
+	}
+	h, err := LastHeight()
+	if err != nil {
+		t.Fatalf("last height error %v", err)
+	}
+	txid := util.RandomString(64)
+	fakeRPC.AddIncoming(monerorpc.Transfer{
+		Txid:         txid,
+		Amount:       CurrentPrice,
+		Height:       h + 1,
+		SubaddrIndex: monerorpc.SubaddressIndex{Major: pot.AccountIndex, Minor: acct.AddressIndex},
+	})
+	checkTransfers()
+	// the account of an inactive pot still has its own wallet account index
+	var accountID int64
+	if err := dbx.Get(&accountID, `SELECT account_id FROM transactions WHERE id = $1`, txid); err != nil || accountID != acct.ID {
+		t.Errorf("Wanted transaction %s for account %d got %d %v", txid, acct.ID, accountID, err)
+	}
+}
+
+func TestWalletForCancelled(t *testing.T) {
+	pot, err := GetPot(DefaultPotID)
+	if err != nil {
+		t.Fatalf("get pot error %v", err)
+	}
+	// a request waiting for the wallet gives up with it
+	w := Wallet.(*lockedWallet)
+	w.sem <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err = GetWalletAddress(ctx, pot.AccountIndex)
+	cancel()
+	<-w.sem
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wanted deadline exceeded waiting for the wallet got %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetWalletAddress(ctx, pot.AccountIndex); err == nil {
+		t.Errorf("Wanted a cancelled request to fail")
+	}
+	if _, err := GetWalletAddress(context.Background(), pot.AccountIndex); err != nil {
+		t.Errorf("get wallet address error %v", err)
+	}
 }
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+
+	"moneropot/util"
+)
+
+type (
+	// WinnerSelector scores entries against the first block of the month, entries with
+	// the highest score win and ties split the prize
+	WinnerSelector interface {
+		Score(block string, signKey string, id int64, totalEntries int64) int
+	}
+
+	// alignSelector counts the characters matching in the same position of both hashes
+	alignSelector struct{}
+
+	// charSelector counts the characters both hashes share regardless of position
+	charSelector struct{}
+
+	// modSelector picks entry (block mod total entries) + 1, the others rank by distance after it
+	modSelector struct{}
+)
+
+const DefaultAlgorithm = "align"
+
+var (
+	winnerSelectors = map[string]WinnerSelector{
+		"align": alignSelector{},
+		"char":  charSelector{},
+		"mod":   modSelector{},
+	}
+)
+
+func (alignSelector) Score(block string, signKey string, id int64, totalEntries int64) int {
+	return util.HashMatchAlign(block, util.SignEntry(id, signKey))
+}
+
+func (charSelector) Score(block string, signKey string, id int64, totalEntries int64) int {
+	return util.HashMatchChar(block, util.SignEntry(id, signKey))
+}
+
+func (modSelector) Score(block string, signKey string, id int64, totalEntries int64) int {
+	b, ok := new(big.Int).SetString(block, 16)
+	if !ok || totalEntries < 1 {
+		return 0
+	}
+	r := new(big.Int).Mod(b, big.NewInt(totalEntries)).Int64()
+	return int(totalEntries - (id-1-r+totalEntries)%totalEntries)
+}
+
+// GetWinnerSelector returns the selector for an algorithm name, empty is the original align rule
+func GetWinnerSelector(name string) (WinnerSelector, error) {
+	if name == "" {
+		name = DefaultAlgorithm
+	}
+	sel, ok := winnerSelectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown draw algorithm %s", name)
+	}
+	return sel, nil
+}
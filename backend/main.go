@@ -2,7 +2,6 @@ package main
 
 import (
 	"embed"
-	"log"
 	"net/http"
 
 	"moneropot/api"
@@ -23,6 +22,6 @@ func main() {
 		Handler: api.NewServer(),
 		Addr:    util.Config.Bind,
 	}
-	log.Printf("moneropot: http://%s", util.Config.Bind)
-	log.Fatal(srv.ListenAndServe())
+	util.Log.Info("listening", "url", "http://"+util.Config.Bind)
+	util.Log.Fatal("server stopped", "error", srv.ListenAndServe())
 }
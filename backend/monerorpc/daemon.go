@@ -0,0 +1,162 @@
+package monerorpc
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type (
+	GetInfoResponse struct {
+		Height                   uint64 `json:"height"`
+		TargetHeight             uint64 `json:"target_height"`
+		Difficulty               uint64 `json:"difficulty"`
+		CumulativeDifficulty     uint64 `json:"cumulative_difficulty"`
+		TopBlockHash             string `json:"top_block_hash"`
+		TxCount                  uint64 `json:"tx_count"`
+		TxPoolSize               uint64 `json:"tx_pool_size"`
+		AltBlocksCount           uint64 `json:"alt_blocks_count"`
+		IncomingConnectionsCount uint64 `json:"incoming_connections_count"`
+		OutgoingConnectionsCount uint64 `json:"outgoing_connections_count"`
+		WhitePeerlistSize        uint64 `json:"white_peerlist_size"`
+		GreyPeerlistSize         uint64 `json:"grey_peerlist_size"`
+		BlockSizeLimit           uint64 `json:"block_size_limit"`
+		BlockWeightLimit         uint64 `json:"block_weight_limit"`
+		DatabaseSize             uint64 `json:"database_size"`
+		StartTime                uint64 `json:"start_time"`
+		Nettype                  string `json:"nettype"`
+		Mainnet                  bool   `json:"mainnet"`
+		Testnet                  bool   `json:"testnet"`
+		Stagenet                 bool   `json:"stagenet"`
+		Offline                  bool   `json:"offline"`
+		Synchronized             bool   `json:"synchronized"`
+		BusySyncing              bool   `json:"busy_syncing"`
+		UpdateAvailable          bool   `json:"update_available"`
+		Version                  string `json:"version"`
+		Status                   string `json:"status"`
+		Untrusted                bool   `json:"untrusted"`
+	}
+
+	// GetBlockRequest looks up a block by Hash when set, otherwise by Height
+	GetBlockRequest struct {
+		Height uint64 `json:"height,omitempty"`
+		Hash   string `json:"hash,omitempty"`
+	}
+
+	GetBlockResponse struct {
+		Blob        string      `json:"blob"`
+		BlockHeader BlockHeader `json:"block_header"`
+		Json        string      `json:"json"`
+		MinerTxHash string      `json:"miner_tx_hash"`
+		TxHashes    []string    `json:"tx_hashes"`
+		Status      string      `json:"status"`
+		Untrusted   bool        `json:"untrusted"`
+	}
+
+	GetFeeEstimateRequest struct {
+		GraceBlocks uint64 `json:"grace_blocks,omitempty"`
+	}
+
+	// GetFeeEstimateResponse has the per byte fee, Fees has one for each priority
+	GetFeeEstimateResponse struct {
+		Fee              uint64   `json:"fee"`
+		Fees             []uint64 `json:"fees"`
+		QuantizationMask uint64   `json:"quantization_mask"`
+		Status           string   `json:"status"`
+		Untrusted        bool     `json:"untrusted"`
+	}
+
+	PoolTransaction struct {
+		IdHash             string `json:"id_hash"`
+		BlobSize           uint64 `json:"blob_size"`
+		Weight             uint64 `json:"weight"`
+		Fee                uint64 `json:"fee"`
+		ReceiveTime        uint64 `json:"receive_time"`
+		Relayed            bool   `json:"relayed"`
+		LastRelayedTime    uint64 `json:"last_relayed_time"`
+		DoNotRelay         bool   `json:"do_not_relay"`
+		DoubleSpendSeen    bool   `json:"double_spend_seen"`
+		KeptByBlock        bool   `json:"kept_by_block"`
+		LastFailedHeight   uint64 `json:"last_failed_height"`
+		LastFailedIdHash   string `json:"last_failed_id_hash"`
+		MaxUsedBlockHeight uint64 `json:"max_used_block_height"`
+		MaxUsedBlockIdHash string `json:"max_used_block_id_hash"`
+		TxBlob             string `json:"tx_blob"`
+		TxJson             string `json:"tx_json"`
+	}
+
+	SpentKeyImage struct {
+		IdHash    string   `json:"id_hash"`
+		TxsHashes []string `json:"txs_hashes"`
+	}
+
+	GetTransactionPoolResponse struct {
+		Transactions   []PoolTransaction `json:"transactions"`
+		SpentKeyImages []SpentKeyImage   `json:"spent_key_images"`
+		Status         string            `json:"status"`
+		Untrusted      bool              `json:"untrusted"`
+	}
+)
+
+// DoPath calls one of the daemon's other rpc endpoints, those take plain json next to /json_rpc
+func (c *Client) DoPath(path string, in, out interface{}) error {
+	return c.DoPathContext(context.Background(), path, in, out)
+}
+
+func (c *Client) DoPathContext(ctx context.Context, path string, in, out interface{}) (err error) {
+	if c.observe != nil {
+		defer func(st time.Time) {
+			c.observe(path, time.Since(st), err)
+		}(time.Now())
+	}
+	if in == nil {
+		in = struct{}{}
+	}
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	body, err := c.post(ctx, path, strings.TrimSuffix(c.addr, "/json_rpc")+"/"+path, payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (c *Client) GetInfo() (*GetInfoResponse, error) {
+	resp := &GetInfoResponse{}
+	err := c.Do("get_info", nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetBlock(req *GetBlockRequest) (*GetBlockResponse, error) {
+	resp := &GetBlockResponse{}
+	err := c.Do("get_block", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetFeeEstimate(req *GetFeeEstimateRequest) (*GetFeeEstimateResponse, error) {
+	resp := &GetFeeEstimateResponse{}
+	err := c.Do("get_fee_estimate", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetTransactionPool isn't on /json_rpc
+func (c *Client) GetTransactionPool() (*GetTransactionPoolResponse, error) {
+	resp := &GetTransactionPoolResponse{}
+	err := c.DoPath("get_transaction_pool", nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
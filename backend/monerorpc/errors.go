@@ -0,0 +1,112 @@
+package monerorpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/rpc/v2/json2"
+)
+
+type (
+	// RPCError is an error returned by the wallet or daemon in the json rpc response
+	RPCError struct {
+		Code    int
+		Message string
+	}
+
+	// HTTPError is a non 200 response, like a failed digest auth
+	HTTPError struct {
+		StatusCode int
+	}
+
+	// OutcomeUnknownError is a call that isn't retried failing without an answer, the wallet
+	// may still have done it so a transfer may already be relayed
+	OutcomeUnknownError struct {
+		Method string
+		Err    error
+	}
+)
+
+// wallet rpc error codes, see wallet_rpc_server_error_codes.h
+const (
+	ErrCodeUnknown            = -1
+	ErrCodeWrongAddress       = -2
+	ErrCodeDaemonBusy         = -3
+	ErrCodeGenericTransfer    = -4
+	ErrCodeWrongPaymentId     = -5
+	ErrCodeTxNotPossible      = -16
+	ErrCodeNotEnoughMoney     = -17
+	ErrCodeTxTooLarge         = -18
+	ErrCodeNotEnoughOutsToMix = -19
+	ErrCodeZeroDestination    = -20
+)
+
+var (
+	// sending more than one of these could pay twice when only the response was lost
+	noRetry = map[string]bool{
+		"transfer":        true,
+		"transfer_split":  true,
+		"sweep_all":       true,
+		"sweep_dust":      true,
+		"relay_tx":        true,
+		"submit_transfer": true,
+		"create_address":  true,
+		"create_account":  true,
+	}
+)
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %v", e.StatusCode)
+}
+
+func (e *OutcomeUnknownError) Error() string {
+	return fmt.Sprintf("%s outcome unknown: %v", e.Method, e.Err)
+}
+
+func (e *OutcomeUnknownError) Unwrap() error {
+	return e.Err
+}
+
+// IsOutcomeUnknown is true when a transfer may or may not have been done, it must not be sent again
+// until the wallet was checked
+func IsOutcomeUnknown(err error) bool {
+	var e *OutcomeUnknownError
+	return errors.As(err, &e)
+}
+
+func rpcError(err error) error {
+	if e, ok := err.(*json2.Error); ok {
+		return &RPCError{Code: int(e.Code), Message: e.Message}
+	}
+	return err
+}
+
+// ErrorCode is the rpc error code of err or 0 when it isn't an *RPCError
+func ErrorCode(err error) int {
+	var e *RPCError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
+// IsOutsError is true when the wallet couldn't pick ring members, either not enough outputs
+// to mix with or the daemon failing to give random outs which has no code of its own
+func IsOutsError(err error) bool {
+	var e *RPCError
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Code {
+	case ErrCodeNotEnoughOutsToMix:
+		return true
+	case ErrCodeGenericTransfer, ErrCodeUnknown:
+		return strings.Contains(e.Message, "failed to get random outs")
+	}
+	return false
+}
@@ -0,0 +1,384 @@
+// Package fake is an in-process monero-wallet-rpc and monerod for tests. Both are served from
+// the same json rpc endpoint so one Server can back the wallet and the daemon client.
+package fake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	"moneropot/monerorpc"
+)
+
+type (
+	// Handler answers a json rpc method, returning a *monerorpc.RPCError sends it as the rpc error
+	Handler func(params json.RawMessage) (interface{}, error)
+
+	// Tx is a transfer made by the wallet
+	Tx struct {
+		Hash         string
+		Key          string
+		Metadata     string
+		AccountIndex uint64
+		Destinations []monerorpc.Destination
+		Fee          uint64
+		Relayed      bool
+		// Height is 0 until the tx is mined
+		Height uint64
+	}
+
+	Server struct {
+		*httptest.Server
+
+		mu       sync.Mutex
+		handlers map[string]Handler
+		calls    map[string]int
+		drops    map[string]int
+		accounts [][]string
+		balances map[uint64][2]uint64
+		incoming []monerorpc.Transfer
+		txs      []*Tx
+		tip      uint64
+		tipTime  uint64
+		hashes   map[uint64]string
+		viewOnly bool
+		fee      uint64
+	}
+
+	request struct {
+		ID     interface{}     `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	rpcErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	response struct {
+		ID      interface{} `json:"id"`
+		Version string      `json:"jsonrpc"`
+		Result  interface{} `json:"result,omitempty"`
+		Error   *rpcErr     `json:"error,omitempty"`
+	}
+)
+
+const (
+	// BlockTime is the spacing of the generated chain
+	BlockTime = 120
+
+	DefaultFee = 30000000
+)
+
+// New starts a server with one account and a chain whose tip is at height 2496780,
+// call Close when done
+func New() *Server {
+	s := &Server{
+		handlers: make(map[string]Handler),
+		calls:    make(map[string]int),
+		drops:    make(map[string]int),
+		balances: make(map[uint64][2]uint64),
+		hashes:   make(map[uint64]string),
+		tip:      2496780,
+		tipTime:  1637336695,
+		fee:      DefaultFee,
+	}
+	s.accounts = [][]string{{s.address(0, 0)}}
+	s.routes()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Address is the json rpc address for monerorpc.Config
+func (s *Server) Address() string {
+	return s.URL + "/json_rpc"
+}
+
+// Client is a monerorpc client of the server
+func (s *Server) Client() *monerorpc.Client {
+	return monerorpc.New(monerorpc.Config{Address: s.Address()})
+}
+
+// Handle replaces or adds a method
+func (s *Server) Handle(method string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Handler is the current handler of method
+func (s *Server) Handler(method string) Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handlers[method]
+}
+
+// Calls is how many times method was called
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// DropResponse closes the connection instead of answering the next n calls of method,
+// the call is still made like a wallet that relayed a transfer but lost the response
+func (s *Server) DropResponse(method string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops[method] = n
+}
+
+// SetBalance sets an account balance, transfers don't change it
+func (s *Server) SetBalance(account uint64, balance uint64, unlocked uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances[account] = [2]uint64{balance, unlocked}
+}
+
+// SetViewOnly makes transfers return an unsigned_txset to sign with sign_transfer
+func (s *Server) SetViewOnly(viewOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.viewOnly = viewOnly
+}
+
+// SetFee sets the fee of every following tx
+func (s *Server) SetFee(fee uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fee = fee
+}
+
+// SetTip moves the chain tip, blocks before it are BlockTime apart
+func (s *Server) SetTip(height uint64, timestamp uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tip = height
+	s.tipTime = timestamp
+}
+
+// SetBlockHash overrides the generated hash of a block
+func (s *Server) SetBlockHash(height uint64, hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[height] = hash
+}
+
+// HeightAt is the first block mined at or after timestamp
+func (s *Server) HeightAt(timestamp uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timestamp >= s.tipTime {
+		return s.tip
+	}
+	return s.tip - (s.tipTime-timestamp)/BlockTime
+}
+
+// Mine adds n blocks, relayed txs go in the first one
+func (s *Server) Mine(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range s.txs {
+		if tx.Relayed && tx.Height == 0 {
+			tx.Height = s.tip + 1
+		}
+	}
+	s.tip += n
+	s.tipTime += n * BlockTime
+}
+
+// AddIncoming adds a transfer received by the wallet, a zero Height is in the pool
+func (s *Server) AddIncoming(t monerorpc.Transfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.Type = "in"
+	if t.Height == 0 {
+		t.Type = "pool"
+	}
+	s.incoming = append(s.incoming, t)
+}
+
+// Txs is every transfer made so far, relayed or not
+func (s *Server) Txs() []Tx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txs := make([]Tx, len(s.txs))
+	for i, tx := range s.txs {
+		txs[i] = *tx
+	}
+	return txs
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	var (
+		req    request
+		result interface{}
+		err    error
+	)
+	method := strings.TrimPrefix(r.URL.Path, "/")
+	jsonRPC := method == "json_rpc"
+	if jsonRPC {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		method = req.Method
+	} else {
+		if err := json.NewDecoder(r.Body).Decode(&req.Params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	s.mu.Lock()
+	s.calls[method]++
+	h, ok := s.handlers[method]
+	s.mu.Unlock()
+	if ok {
+		result, err = h(req.Params)
+	} else {
+		err = &monerorpc.RPCError{Code: -32601, Message: "Method not found"}
+	}
+	s.mu.Lock()
+	drop := s.drops[method] > 0
+	if drop {
+		s.drops[method]--
+	}
+	s.mu.Unlock()
+	if drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !jsonRPC {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	resp := response{ID: req.ID, Version: "2.0", Result: result}
+	if err != nil {
+		resp.Result = nil
+		resp.Error = &rpcErr{Code: monerorpc.ErrCodeUnknown, Message: err.Error()}
+		if e, ok := err.(*monerorpc.RPCError); ok {
+			resp.Error = &rpcErr{Code: e.Code, Message: e.Message}
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func hash(parts ...interface{}) string {
+	h := sha256.Sum256([]byte(fmt.Sprint(parts...)))
+	return hex.EncodeToString(h[:])
+}
+
+// address is a made up 95 char standard or subaddress
+func (s *Server) address(account uint64, index uint64) string {
+	prefix := "4"
+	if account > 0 || index > 0 {
+		prefix = "8"
+	}
+	return fmt.Sprintf("%s%030d%s", prefix, account<<16|index, hash("address", account, index))
+}
+
+// header needs mu
+func (s *Server) header(height uint64) monerorpc.BlockHeader {
+	h, ok := s.hashes[height]
+	if !ok {
+		h = hash("block", height)
+	}
+	return monerorpc.BlockHeader{
+		Hash:      h,
+		Height:    height,
+		Timestamp: s.tipTime - (s.tip-height)*BlockTime,
+		PrevHash:  hash("block", height-1),
+		Depth:     s.tip - height,
+	}
+}
+
+// findTx needs mu
+func (s *Server) findTx(f func(tx *Tx) bool) *Tx {
+	for _, tx := range s.txs {
+		if f(tx) {
+			return tx
+		}
+	}
+	return nil
+}
+
+// newTx needs mu
+func (s *Server) newTx(account uint64, dests []monerorpc.Destination, relay bool) *Tx {
+	n := len(s.txs)
+	tx := &Tx{
+		Hash:         hash("tx", n),
+		Key:          hash("key", n),
+		Metadata:     hash("metadata", n),
+		AccountIndex: account,
+		Destinations: dests,
+		Fee:          s.fee,
+		Relayed:      relay && !s.viewOnly,
+	}
+	s.txs = append(s.txs, tx)
+	return tx
+}
+
+func (tx *Tx) amount() uint64 {
+	var total uint64
+	for _, d := range tx.Destinations {
+		total += d.Amount
+	}
+	return total
+}
+
+// transfer needs mu, a mined tx is out and a relayed one pending
+func (s *Server) transfer(tx *Tx) monerorpc.Transfer {
+	t := monerorpc.Transfer{
+		Txid:         tx.Hash,
+		Amount:       tx.amount(),
+		Fee:          tx.Fee,
+		Height:       tx.Height,
+		Destinations: tx.Destinations,
+		SubaddrIndex: monerorpc.SubaddressIndex{Major: tx.AccountIndex},
+		Type:         "pending",
+	}
+	if tx.Height > 0 {
+		t.Type = "out"
+		t.Confirmations = s.tip - tx.Height + 1
+		t.Timestamp = s.header(tx.Height).Timestamp
+	}
+	return t
+}
+
+func unsignedTxset(tx *Tx) string {
+	return "unsigned" + tx.Hash
+}
+
+func signedTxset(tx *Tx) string {
+	return "signed" + tx.Hash
+}
+
+// sortedIncoming needs mu
+func (s *Server) sortedIncoming() []monerorpc.Transfer {
+	in := append([]monerorpc.Transfer{}, s.incoming...)
+	sort.SliceStable(in, func(i, j int) bool {
+		return in[i].Height < in[j].Height
+	})
+	for i := range in {
+		if in[i].Height > 0 {
+			in[i].Confirmations = s.tip - in[i].Height + 1
+		}
+	}
+	return in
+}
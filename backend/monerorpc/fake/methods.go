@@ -0,0 +1,464 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"moneropot/monerorpc"
+)
+
+func decode(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &monerorpc.RPCError{Code: -32602, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) routes() {
+	wallet := map[string]Handler{
+		"create_address":       s.createAddress,
+		"create_account":       s.createAccount,
+		"get_address":          s.getAddress,
+		"validate_address":     s.validateAddress,
+		"make_uri":             s.makeUri,
+		"get_balance":          s.getBalance,
+		"get_transfers":        s.getTransfers,
+		"get_transfer_by_txid": s.getTransferByTxid,
+		"transfer":             s.transferOne,
+		"transfer_split":       s.transferSplit,
+		"relay_tx":             s.relayTx,
+		"sign_transfer":        s.signTransfer,
+		"submit_transfer":      s.submitTransfer,
+		"get_tx_key":           s.getTxKey,
+		"check_tx_key":         s.checkTxKey,
+		"get_height":           s.getHeight,
+		"get_version":          s.getVersion,
+		"refresh":              s.empty,
+		"store":                s.empty,
+	}
+	daemon := map[string]Handler{
+		"get_last_block_header":   s.getLastBlockHeader,
+		"get_block_headers_range": s.getBlockHeadersRange,
+		"get_block":               s.getBlock,
+		"get_info":                s.getInfo,
+		"get_fee_estimate":        s.getFeeEstimate,
+		"get_transaction_pool":    s.getTransactionPool,
+	}
+	for _, m := range []map[string]Handler{wallet, daemon} {
+		for method, h := range m {
+			s.handlers[method] = h
+		}
+	}
+}
+
+func (s *Server) empty(params json.RawMessage) (interface{}, error) {
+	return struct{}{}, nil
+}
+
+func (s *Server) createAddress(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.CreateAddressRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.AccountIndex >= uint64(len(s.accounts)) {
+		return nil, &monerorpc.RPCError{Code: -14, Message: "account index is out of bound"}
+	}
+	index := uint64(len(s.accounts[req.AccountIndex]))
+	addr := s.address(req.AccountIndex, index)
+	s.accounts[req.AccountIndex] = append(s.accounts[req.AccountIndex], addr)
+	return &monerorpc.CreateAddressResponse{Address: addr, AddressIndex: index}, nil
+}
+
+func (s *Server) createAccount(params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := uint64(len(s.accounts))
+	addr := s.address(index, 0)
+	s.accounts = append(s.accounts, []string{addr})
+	return &monerorpc.CreateAccountResponse{AccountIndex: index, Address: addr}, nil
+}
+
+func (s *Server) getAddress(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.GetAddressRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.AccountIndex >= uint64(len(s.accounts)) {
+		return nil, &monerorpc.RPCError{Code: -14, Message: "account index is out of bound"}
+	}
+	addrs := s.accounts[req.AccountIndex]
+	resp := &monerorpc.GetAddressResponse{Address: addrs[0]}
+	for i, addr := range addrs {
+		wanted := len(req.AddressIndex) == 0
+		for _, index := range req.AddressIndex {
+			wanted = wanted || index == uint64(i)
+		}
+		if wanted {
+			resp.Addresses = append(resp.Addresses, monerorpc.Address{AddressIndex: uint64(i), Address: addr})
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) validateAddress(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.ValidateAddressRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	resp := &monerorpc.ValidateAddressResponse{}
+	if len(req.Address) != 95 && len(req.Address) != 106 {
+		return resp, nil
+	}
+	resp.Valid = true
+	resp.Integrated = len(req.Address) == 106
+	resp.Subaddress = strings.ContainsAny(req.Address[:1], "8B7")
+	switch {
+	case strings.ContainsAny(req.Address[:1], "48"):
+		resp.Nettype = "mainnet"
+	case strings.ContainsAny(req.Address[:1], "9AB"):
+		resp.Nettype = "testnet"
+	default:
+		resp.Nettype = "stagenet"
+	}
+	return resp, nil
+}
+
+func (s *Server) makeUri(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.MakeUriRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	uri := "monero:" + req.Address
+	if req.Amount > 0 {
+		uri += "?tx_amount=" + monerorpc.XMRToDecimal(req.Amount)
+	}
+	return &monerorpc.MakeUriResponse{Uri: uri}, nil
+}
+
+func (s *Server) getBalance(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.GetBalanceRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.balances[req.AccountIndex]
+	return &monerorpc.GetBalanceResponse{Balance: b[0], UnlockedBalance: b[1]}, nil
+}
+
+func (s *Server) getTransfers(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.GetTransfersRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wanted := func(t monerorpc.Transfer) bool {
+		if !req.AllAccounts && t.SubaddrIndex.Major != req.AccountIndex {
+			return false
+		}
+		if req.FilterByHeight && t.Height > 0 {
+			return t.Height > req.MinHeight && (req.MaxHeight == 0 || t.Height <= req.MaxHeight)
+		}
+		return true
+	}
+	resp := &monerorpc.GetTransfersResponse{}
+	for _, t := range s.sortedIncoming() {
+		if !wanted(t) {
+			continue
+		}
+		if t.Type == "in" && req.In {
+			resp.In = append(resp.In, t)
+		} else if t.Type == "pool" && req.Pool {
+			resp.Pool = append(resp.Pool, t)
+		}
+	}
+	for _, tx := range s.txs {
+		if !tx.Relayed {
+			continue
+		}
+		t := s.transfer(tx)
+		if !wanted(t) {
+			continue
+		}
+		if t.Type == "out" && req.Out {
+			resp.Out = append(resp.Out, t)
+		} else if t.Type == "pending" && req.Pending {
+			resp.Pending = append(resp.Pending, t)
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) getTransferByTxid(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.GetTransferByTxidRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &monerorpc.GetTransferByTxidResponse{}
+	for _, t := range s.sortedIncoming() {
+		if t.Txid == req.Txid {
+			resp.Transfers = append(resp.Transfers, t)
+		}
+	}
+	if tx := s.findTx(func(tx *Tx) bool { return tx.Hash == req.Txid && tx.Relayed }); tx != nil {
+		resp.Transfers = append(resp.Transfers, s.transfer(tx))
+	}
+	if len(resp.Transfers) == 0 {
+		return nil, &monerorpc.RPCError{Code: -8, Message: "Transaction not found."}
+	}
+	resp.Transfer = resp.Transfers[0]
+	return resp, nil
+}
+
+func (s *Server) transferOne(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.TransferRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	if len(req.Destinations) == 0 {
+		return nil, &monerorpc.RPCError{Code: monerorpc.ErrCodeZeroDestination, Message: "No destinations for this transfer"}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.newTx(req.AccountIndex, req.Destinations, !req.DoNotRelay)
+	resp := &monerorpc.TransferResponse{Amount: tx.amount(), Fee: tx.Fee}
+	if s.viewOnly {
+		resp.UnsignedTxset = unsignedTxset(tx)
+		return resp, nil
+	}
+	resp.TxHash = tx.Hash
+	if req.GetTxKeys {
+		resp.TxKey = tx.Key
+	}
+	if req.GetTxMetadata {
+		resp.TxMetadata = tx.Metadata
+	}
+	return resp, nil
+}
+
+func (s *Server) transferSplit(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.TransferSplitRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	if len(req.Destinations) == 0 {
+		return nil, &monerorpc.RPCError{Code: monerorpc.ErrCodeZeroDestination, Message: "No destinations for this transfer"}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.newTx(req.AccountIndex, req.Destinations, !req.DoNotRelay)
+	resp := &monerorpc.TransferSplitResponse{
+		AmountList: []int{int(tx.amount())},
+		FeeList:    []int{int(tx.Fee)},
+	}
+	if s.viewOnly {
+		resp.UnsignedTxset = unsignedTxset(tx)
+		return resp, nil
+	}
+	resp.TxHashList = []string{tx.Hash}
+	if req.GetTxKeys {
+		resp.TxKeyList = []string{tx.Key}
+	}
+	if req.GetTxMetadata {
+		resp.TxMetadataList = []string{tx.Metadata}
+	}
+	return resp, nil
+}
+
+func (s *Server) relayTx(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.RelayTxRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.findTx(func(tx *Tx) bool { return tx.Metadata == req.Hex && !tx.Relayed })
+	if tx == nil {
+		return nil, &monerorpc.RPCError{Code: -24, Message: "Failed to parse tx metadata."}
+	}
+	tx.Relayed = true
+	return &monerorpc.RelayTxResponse{TxHash: tx.Hash}, nil
+}
+
+func (s *Server) signTransfer(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.SignTransferRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.findTx(func(tx *Tx) bool { return unsignedTxset(tx) == req.UnsignedTxset })
+	if tx == nil {
+		return nil, &monerorpc.RPCError{Code: -21, Message: "cannot load unsigned_txset"}
+	}
+	resp := &monerorpc.SignTransferResponse{SignedTxset: signedTxset(tx), TxHashList: []string{tx.Hash}}
+	if req.GetTxKeys {
+		resp.TxKeyList = []string{tx.Key}
+	}
+	return resp, nil
+}
+
+func (s *Server) submitTransfer(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.SubmitTransferRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.findTx(func(tx *Tx) bool { return signedTxset(tx) == req.TxDataHex && !tx.Relayed })
+	if tx == nil {
+		return nil, &monerorpc.RPCError{Code: -21, Message: "Failed to load signed transactions"}
+	}
+	tx.Relayed = true
+	return &monerorpc.SubmitTransferResponse{TxHashList: []string{tx.Hash}}, nil
+}
+
+func (s *Server) getTxKey(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.GetTxKeyRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.findTx(func(tx *Tx) bool { return tx.Hash == req.Txid && tx.Relayed })
+	if tx == nil {
+		return nil, &monerorpc.RPCError{Code: -8, Message: "Tx not found"}
+	}
+	return &monerorpc.GetTxKeyResponse{TxKey: tx.Key}, nil
+}
+
+func (s *Server) checkTxKey(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.CheckTxKeyRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.findTx(func(tx *Tx) bool { return tx.Hash == req.Txid && tx.Relayed })
+	if tx == nil || tx.Key != req.TxKey {
+		return nil, &monerorpc.RPCError{Code: -22, Message: "Tx key does not match"}
+	}
+	t := s.transfer(tx)
+	resp := &monerorpc.CheckTxKeyResponse{Confirmations: t.Confirmations, InPool: tx.Height == 0}
+	for _, d := range tx.Destinations {
+		if d.Address == req.Address {
+			resp.Received += d.Amount
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) getHeight(params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &monerorpc.GetHeightResponse{Height: s.tip + 1}, nil
+}
+
+func (s *Server) getVersion(params json.RawMessage) (interface{}, error) {
+	return &monerorpc.GetVersionResponse{Version: 1<<16 | 23, Release: true}, nil
+}
+
+func (s *Server) getLastBlockHeader(params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &monerorpc.GetLastBlockHeaderResponse{BlockHeader: s.header(s.tip)}, nil
+}
+
+func (s *Server) getBlockHeadersRange(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.GetBlockHeadersRangeRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.StartHeight > req.EndHeight || req.EndHeight > s.tip {
+		return nil, &monerorpc.RPCError{Code: -2, Message: "Invalid start/end heights."}
+	}
+	resp := &monerorpc.GetLastBlockHeadersRangeResponse{}
+	for h := req.StartHeight; h <= req.EndHeight; h++ {
+		resp.BlockHeaders = append(resp.BlockHeaders, s.header(h))
+	}
+	return resp, nil
+}
+
+func (s *Server) getBlock(params json.RawMessage) (interface{}, error) {
+	req := &monerorpc.GetBlockRequest{}
+	if err := decode(params, req); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	height := req.Height
+	if req.Hash != "" {
+		found := false
+		for h := range s.hashes {
+			if s.hashes[h] == req.Hash {
+				height, found = h, true
+			}
+		}
+		// generated hashes can't be reversed, only look near the tip
+		for h := s.tip; !found && h+1000 > s.tip && h > 0; h-- {
+			if s.header(h).Hash == req.Hash {
+				height, found = h, true
+			}
+		}
+		if !found {
+			return nil, &monerorpc.RPCError{Code: -5, Message: fmt.Sprintf("Internal error: can't get block by hash. Hash = %s.", req.Hash)}
+		}
+	}
+	if height > s.tip {
+		return nil, &monerorpc.RPCError{Code: -2, Message: "Requested block height is greater than current top block height"}
+	}
+	return &monerorpc.GetBlockResponse{BlockHeader: s.header(height), Status: "OK"}, nil
+}
+
+func (s *Server) getInfo(params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &monerorpc.GetInfoResponse{
+		Height:       s.tip + 1,
+		TargetHeight: s.tip + 1,
+		TopBlockHash: s.header(s.tip).Hash,
+		Nettype:      "testnet",
+		Testnet:      true,
+		Synchronized: true,
+		Status:       "OK",
+	}, nil
+}
+
+func (s *Server) getFeeEstimate(params json.RawMessage) (interface{}, error) {
+	return &monerorpc.GetFeeEstimateResponse{
+		Fee:              20000,
+		Fees:             []uint64{20000, 80000, 320000, 4000000},
+		QuantizationMask: 10000,
+		Status:           "OK",
+	}, nil
+}
+
+func (s *Server) getTransactionPool(params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &monerorpc.GetTransactionPoolResponse{Status: "OK"}
+	for _, tx := range s.txs {
+		if tx.Relayed && tx.Height == 0 {
+			resp.Transactions = append(resp.Transactions, monerorpc.PoolTransaction{
+				IdHash:      tx.Hash,
+				Fee:         tx.Fee,
+				Relayed:     true,
+				ReceiveTime: s.tipTime,
+			})
+		}
+	}
+	return resp, nil
+}
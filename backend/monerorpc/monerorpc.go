@@ -2,22 +2,39 @@ package monerorpc
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/rpc/v2/json2"
 )
 
 type (
+	// Config Timeout is per attempt, transport errors are retried Retries times
+	// waiting RetryWait doubled after every attempt. Calls that aren't retried, like transfers,
+	// use SendTimeout instead, none when 0. Observe is told how long each call took.
 	Config struct {
 		Address       string
 		CustomHeaders map[string]string
 		Transport     http.RoundTripper
+		Timeout       time.Duration
+		SendTimeout   time.Duration
+		Retries       int
+		RetryWait     time.Duration
+		Observe       func(method string, d time.Duration, err error)
 	}
 	Client struct {
-		httpcl  *http.Client
-		addr    string
-		headers map[string]string
+		httpcl      *http.Client
+		addr        string
+		headers     map[string]string
+		timeout     time.Duration
+		sendTimeout time.Duration
+		retries     int
+		retryWait   time.Duration
+		observe     func(method string, d time.Duration, err error)
+		ctx         context.Context
 	}
 
 	Address struct {
@@ -86,6 +103,15 @@ type (
 		Address      string `json:"address"`
 		AddressIndex uint64 `json:"address_index"`
 	}
+	CreateAccountRequest struct {
+		Label string `json:"label,omitempty"`
+	}
+
+	CreateAccountResponse struct {
+		AccountIndex uint64 `json:"account_index"`
+		Address      string `json:"address"`
+	}
+
 	GetBalanceRequest struct {
 		AccountIndex   uint64   `json:"account_index"`
 		AddressIndices []uint64 `json:"address_indices,omitempty"`
@@ -109,6 +135,7 @@ type (
 		MaxHeight      uint64   `json:"max_height,omitempty"`
 		AccountIndex   uint64   `json:"account_index,omitempty"`
 		SubaddrIndices []uint64 `json:"subaddr_indices,omitempty"`
+		AllAccounts    bool     `json:"all_accounts,omitempty"`
 	}
 
 	Transfer struct {
@@ -126,6 +153,7 @@ type (
 		Txid                            string          `json:"txid"`
 		Type                            string          `json:"type"`
 		UnlockTime                      uint64          `json:"unlock_time"`
+		Destinations                    []Destination   `json:"destinations,omitempty"`
 	}
 
 	GetTransfersResponse struct {
@@ -185,6 +213,168 @@ type (
 		UnsignedTxset  string   `json:"unsigned_txset"`
 	}
 
+	RelayTxRequest struct {
+		Hex string `json:"hex"`
+	}
+
+	RelayTxResponse struct {
+		TxHash string `json:"tx_hash"`
+	}
+
+	SignTransferRequest struct {
+		UnsignedTxset string `json:"unsigned_txset"`
+		ExportRaw     bool   `json:"export_raw,omitempty"`
+		GetTxKeys     bool   `json:"get_tx_keys,omitempty"`
+	}
+
+	SignTransferResponse struct {
+		SignedTxset string   `json:"signed_txset"`
+		TxHashList  []string `json:"tx_hash_list"`
+		TxRawList   []string `json:"tx_raw_list,omitempty"`
+		TxKeyList   []string `json:"tx_key_list"`
+	}
+
+	SubmitTransferRequest struct {
+		TxDataHex string `json:"tx_data_hex"`
+	}
+
+	SubmitTransferResponse struct {
+		TxHashList []string `json:"tx_hash_list"`
+	}
+
+	GetHeightResponse struct {
+		Height uint64 `json:"height"`
+	}
+
+	GetTransferByTxidRequest struct {
+		Txid         string `json:"txid"`
+		AccountIndex uint64 `json:"account_index,omitempty"`
+	}
+
+	// GetTransferByTxidResponse has every transfer of the tx in Transfers when it
+	// pays more than one subaddress, Transfer is the first of them
+	GetTransferByTxidResponse struct {
+		Transfer  Transfer   `json:"transfer"`
+		Transfers []Transfer `json:"transfers"`
+	}
+
+	IncomingTransfersRequest struct {
+		TransferType   string   `json:"transfer_type"`
+		AccountIndex   uint64   `json:"account_index,omitempty"`
+		SubaddrIndices []uint64 `json:"subaddr_indices,omitempty"`
+	}
+
+	IncomingTransfer struct {
+		Amount       uint64          `json:"amount"`
+		BlockHeight  uint64          `json:"block_height"`
+		Frozen       bool            `json:"frozen"`
+		GlobalIndex  uint64          `json:"global_index"`
+		KeyImage     string          `json:"key_image"`
+		Pubkey       string          `json:"pubkey"`
+		Spent        bool            `json:"spent"`
+		SubaddrIndex SubaddressIndex `json:"subaddr_index"`
+		TxHash       string          `json:"tx_hash"`
+		Unlocked     bool            `json:"unlocked"`
+	}
+
+	IncomingTransfersResponse struct {
+		Transfers []IncomingTransfer `json:"transfers"`
+	}
+
+	SweepAllRequest struct {
+		Address           string   `json:"address"`
+		AccountIndex      uint64   `json:"account_index,omitempty"`
+		SubaddrIndices    []uint64 `json:"subaddr_indices,omitempty"`
+		SubaddrIndicesAll bool     `json:"subaddr_indices_all,omitempty"`
+		Priority          uint64   `json:"priority"`
+		RingSize          uint64   `json:"ring_size,omitempty"`
+		UnlockTime        uint64   `json:"unlock_time"`
+		GetTxKeys         bool     `json:"get_tx_keys,omitempty"`
+		BelowAmount       uint64   `json:"below_amount,omitempty"`
+		DoNotRelay        bool     `json:"do_not_relay,omitempty"`
+		GetTxHex          bool     `json:"get_tx_hex"`
+		GetTxMetadata     bool     `json:"get_tx_metadata"`
+	}
+
+	SweepDustRequest struct {
+		GetTxKeys     bool `json:"get_tx_keys,omitempty"`
+		DoNotRelay    bool `json:"do_not_relay,omitempty"`
+		GetTxHex      bool `json:"get_tx_hex"`
+		GetTxMetadata bool `json:"get_tx_metadata"`
+	}
+
+	// SweepResponse is returned by both sweep_all and sweep_dust
+	SweepResponse struct {
+		TxHashList     []string `json:"tx_hash_list"`
+		TxKeyList      []string `json:"tx_key_list"`
+		AmountList     []uint64 `json:"amount_list"`
+		FeeList        []uint64 `json:"fee_list"`
+		WeightList     []uint64 `json:"weight_list"`
+		TxBlobList     []string `json:"tx_blob_list"`
+		TxMetadataList []string `json:"tx_metadata_list"`
+		MultisigTxset  string   `json:"multisig_txset"`
+		UnsignedTxset  string   `json:"unsigned_txset"`
+	}
+
+	CheckTxKeyRequest struct {
+		Txid    string `json:"txid"`
+		TxKey   string `json:"tx_key"`
+		Address string `json:"address"`
+	}
+
+	CheckTxKeyResponse struct {
+		Confirmations uint64 `json:"confirmations"`
+		InPool        bool   `json:"in_pool"`
+		Received      uint64 `json:"received"`
+	}
+
+	GetTxKeyRequest struct {
+		Txid string `json:"txid"`
+	}
+
+	GetTxKeyResponse struct {
+		TxKey string `json:"tx_key"`
+	}
+
+	GetTxProofRequest struct {
+		Txid    string `json:"txid"`
+		Address string `json:"address"`
+		Message string `json:"message,omitempty"`
+	}
+
+	GetTxProofResponse struct {
+		Signature string `json:"signature"`
+	}
+
+	CheckTxProofRequest struct {
+		Txid      string `json:"txid"`
+		Address   string `json:"address"`
+		Message   string `json:"message,omitempty"`
+		Signature string `json:"signature"`
+	}
+
+	CheckTxProofResponse struct {
+		Confirmations uint64 `json:"confirmations"`
+		Good          bool   `json:"good"`
+		InPool        bool   `json:"in_pool"`
+		Received      uint64 `json:"received"`
+	}
+
+	RefreshRequest struct {
+		StartHeight uint64 `json:"start_height,omitempty"`
+	}
+
+	RefreshResponse struct {
+		BlocksFetched uint64 `json:"blocks_fetched"`
+		ReceivedMoney bool   `json:"received_money"`
+	}
+
+	// GetVersionResponse is major << 16 | minor of the rpc version
+	GetVersionResponse struct {
+		Version uint64 `json:"version"`
+		Release bool   `json:"release"`
+	}
+
 	MakeUriRequest struct {
 		Address       string `json:"address"`
 		Amount        uint64 `json:"amount,omitempty"`
@@ -208,9 +398,21 @@ type (
 	}
 
 	BlockHeader struct {
-		Hash      string `json:"hash"`
-		Height    uint64 `json:"height"`
-		Timestamp uint64 `json:"timestamp"`
+		Hash         string `json:"hash"`
+		Height       uint64 `json:"height"`
+		Timestamp    uint64 `json:"timestamp"`
+		PrevHash     string `json:"prev_hash"`
+		Depth        uint64 `json:"depth"`
+		Difficulty   uint64 `json:"difficulty"`
+		MajorVersion uint64 `json:"major_version"`
+		MinorVersion uint64 `json:"minor_version"`
+		Nonce        uint64 `json:"nonce"`
+		NumTxes      uint64 `json:"num_txes"`
+		OrphanStatus bool   `json:"orphan_status"`
+		Reward       uint64 `json:"reward"`
+		BlockSize    uint64 `json:"block_size"`
+		BlockWeight  uint64 `json:"block_weight"`
+		MinerTxHash  string `json:"miner_tx_hash"`
 	}
 
 	GetBlockHeadersRangeRequest struct {
@@ -227,21 +429,18 @@ type (
 	}
 )
 
-var (
-	fakeResponse map[string]func(interface{}) string
-)
-
-func SetFakeResponse(method string, cb func(interface{}) string) {
-	if fakeResponse == nil {
-		fakeResponse = make(map[string]func(interface{}) string)
-	}
-	fakeResponse[method] = cb
-}
-
 func New(cfg Config) *Client {
 	cl := &Client{
-		addr:    cfg.Address,
-		headers: cfg.CustomHeaders,
+		addr:        cfg.Address,
+		headers:     cfg.CustomHeaders,
+		timeout:     cfg.Timeout,
+		sendTimeout: cfg.SendTimeout,
+		retries:     cfg.Retries,
+		retryWait:   cfg.RetryWait,
+		observe:     cfg.Observe,
+	}
+	if cl.retryWait == 0 {
+		cl.retryWait = time.Second
 	}
 	if cfg.Transport == nil {
 		cl.httpcl = http.DefaultClient
@@ -253,42 +452,96 @@ func New(cfg Config) *Client {
 	return cl
 }
 
+// WithContext is a copy of the client whose calls give up once ctx is done
+func (c *Client) WithContext(ctx context.Context) *Client {
+	cl := *c
+	cl.ctx = ctx
+	return &cl
+}
+
 func (c *Client) Do(method string, in, out interface{}) error {
-	if fakeResponse != nil {
-		if cb, ok := fakeResponse[method]; ok {
-			body := fmt.Sprintf(`{"result":%s}`, cb(in))
-			return json2.DecodeClientResponse(bytes.NewReader([]byte(body)), out)
-		}
-		return fmt.Errorf("method: %s not handled in: %v out: %v", method, in, out)
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return c.DoContext(ctx, method, in, out)
+}
+
+// DoContext calls a json rpc method, rpc errors are returned as *RPCError
+func (c *Client) DoContext(ctx context.Context, method string, in, out interface{}) (err error) {
+	if c.observe != nil {
+		defer func(st time.Time) {
+			c.observe(method, time.Since(st), err)
+		}(time.Now())
+	}
+	if out == nil {
+		out = &json2.EmptyResponse{}
 	}
 	payload, err := json2.EncodeClientRequest(method, in)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest(http.MethodPost, c.addr, bytes.NewBuffer(payload))
+	body, err := c.post(ctx, method, c.addr, payload)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.headers != nil {
-		for k, v := range c.headers {
-			req.Header.Set(k, v)
+	return rpcError(json2.DecodeClientResponse(bytes.NewReader(body), out))
+}
+
+// post retries transport errors with backoff, anything the server answered is returned as is,
+// a transport error of a method that isn't retried is an *OutcomeUnknownError
+func (c *Client) post(ctx context.Context, method string, addr string, payload []byte) ([]byte, error) {
+	retry, timeout := !noRetry[method], c.timeout
+	if !retry {
+		timeout = c.sendTimeout
+	}
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		body, err := c.postOnce(ctx, addr, payload, timeout)
+		if err == nil {
+			return body, nil
+		}
+		if _, ok := err.(*HTTPError); ok {
+			return nil, err
+		}
+		if !retry {
+			return nil, &OutcomeUnknownError{Method: method, Err: err}
+		}
+		if attempt >= c.retries || ctx.Err() != nil {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
 		}
+		wait *= 2
 	}
-	resp, err := c.httpcl.Do(req)
+}
+
+func (c *Client) postOnce(ctx context.Context, addr string, payload []byte, timeout time.Duration) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(payload))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("http status %v", resp.StatusCode)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.httpcl.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
-
-	if out == nil {
-		v := &json2.EmptyResponse{}
-		return json2.DecodeClientResponse(resp.Body, v)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{StatusCode: resp.StatusCode}
 	}
-	return json2.DecodeClientResponse(resp.Body, out)
+	return ioutil.ReadAll(resp.Body)
 }
 
 func (c *Client) ValidateAddress(req *ValidateAddressRequest) (*ValidateAddressResponse, error) {
@@ -309,6 +562,15 @@ func (c *Client) CreateAddress(req *CreateAddressRequest) (*CreateAddressRespons
 	return resp, nil
 }
 
+func (c *Client) CreateAccount(req *CreateAccountRequest) (*CreateAccountResponse, error) {
+	resp := &CreateAccountResponse{}
+	err := c.Do("create_account", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 func (c *Client) GetBalance(req *GetBalanceRequest) (*GetBalanceResponse, error) {
 	resp := &GetBalanceResponse{}
 	err := c.Do("get_balance", &req, resp)
@@ -345,6 +607,143 @@ func (c *Client) TransferSplit(req *TransferSplitRequest) (*TransferSplitRespons
 	return resp, nil
 }
 
+// RelayTx relays a transfer made with do_not_relay, hex is its tx_metadata
+func (c *Client) RelayTx(req *RelayTxRequest) (*RelayTxResponse, error) {
+	resp := &RelayTxResponse{}
+	err := c.Do("relay_tx", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SignTransfer signs an unsigned_txset, only on the offline wallet holding the spend key
+func (c *Client) SignTransfer(req *SignTransferRequest) (*SignTransferResponse, error) {
+	resp := &SignTransferResponse{}
+	err := c.Do("sign_transfer", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SubmitTransfer relays a signed_txset from the view-only wallet
+func (c *Client) SubmitTransfer(req *SubmitTransferRequest) (*SubmitTransferResponse, error) {
+	resp := &SubmitTransferResponse{}
+	err := c.Do("submit_transfer", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetHeight() (*GetHeightResponse, error) {
+	resp := &GetHeightResponse{}
+	err := c.Do("get_height", nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetTransferByTxid(req *GetTransferByTxidRequest) (*GetTransferByTxidResponse, error) {
+	resp := &GetTransferByTxidResponse{}
+	err := c.Do("get_transfer_by_txid", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// IncomingTransfers lists the outputs of the wallet, TransferType is all, available or unavailable
+func (c *Client) IncomingTransfers(req *IncomingTransfersRequest) (*IncomingTransfersResponse, error) {
+	resp := &IncomingTransfersResponse{}
+	err := c.Do("incoming_transfers", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) SweepAll(req *SweepAllRequest) (*SweepResponse, error) {
+	resp := &SweepResponse{}
+	err := c.Do("sweep_all", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) SweepDust(req *SweepDustRequest) (*SweepResponse, error) {
+	resp := &SweepResponse{}
+	err := c.Do("sweep_dust", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CheckTxKey checks what the tx paid to address using the tx key given by the sender
+func (c *Client) CheckTxKey(req *CheckTxKeyRequest) (*CheckTxKeyResponse, error) {
+	resp := &CheckTxKeyResponse{}
+	err := c.Do("check_tx_key", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetTxKey(req *GetTxKeyRequest) (*GetTxKeyResponse, error) {
+	resp := &GetTxKeyResponse{}
+	err := c.Do("get_tx_key", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetTxProof signs a proof that the tx paid address, it needs the spend key
+func (c *Client) GetTxProof(req *GetTxProofRequest) (*GetTxProofResponse, error) {
+	resp := &GetTxProofResponse{}
+	err := c.Do("get_tx_proof", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) CheckTxProof(req *CheckTxProofRequest) (*CheckTxProofResponse, error) {
+	resp := &CheckTxProofResponse{}
+	err := c.Do("check_tx_proof", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Refresh(req *RefreshRequest) (*RefreshResponse, error) {
+	resp := &RefreshResponse{}
+	err := c.Do("refresh", &req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Store saves the wallet file
+func (c *Client) Store() error {
+	return c.Do("store", nil, nil)
+}
+
+func (c *Client) GetVersion() (*GetVersionResponse, error) {
+	resp := &GetVersionResponse{}
+	err := c.Do("get_version", nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 func XMRToDecimal(xmr uint64) string {
 	str0 := fmt.Sprintf("%013d", xmr)
 	l := len(str0)
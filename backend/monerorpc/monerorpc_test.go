@@ -0,0 +1,102 @@
+package monerorpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type flakyTransport struct {
+	fails int
+	calls int
+	body  string
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if t.calls <= t.fails {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(t.body)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func TestDoRetries(t *testing.T) {
+	tables := []struct {
+		method  string
+		fails   int
+		calls   int
+		ok      bool
+		unknown bool
+	}{
+		{"get_height", 2, 3, true, false},
+		{"get_height", 5, 4, false, false},
+		{"transfer_split", 1, 1, false, true},
+		{"transfer_split", 0, 1, true, false},
+	}
+	for _, table := range tables {
+		tr := &flakyTransport{fails: table.fails, body: `{"id":1,"jsonrpc":"2.0","result":{"height":100}}`}
+		c := New(Config{Transport: tr, Retries: 3, RetryWait: time.Millisecond})
+		err := c.Do(table.method, nil, &GetHeightResponse{})
+		if (err == nil) != table.ok || tr.calls != table.calls || IsOutcomeUnknown(err) != table.unknown {
+			t.Errorf("%s wanted %d calls ok %v unknown %v got %d calls %v", table.method, table.calls, table.ok, table.unknown, tr.calls, err)
+		}
+	}
+}
+
+type slowTransport struct {
+	delay time.Duration
+}
+
+func (t slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-time.After(t.delay):
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id":1,"jsonrpc":"2.0","result":{"height":100}}`)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func TestSendTimeout(t *testing.T) {
+	c := New(Config{Transport: slowTransport{time.Millisecond * 50}, Timeout: time.Millisecond * 10, RetryWait: time.Millisecond})
+	if err := c.Do("get_height", nil, &GetHeightResponse{}); err == nil || IsOutcomeUnknown(err) {
+		t.Errorf("Wanted get_height to time out got %v", err)
+	}
+	// transfers don't use the per attempt timeout, the wallet may still be relaying
+	if err := c.Do("transfer_split", nil, &GetHeightResponse{}); err != nil {
+		t.Errorf("Wanted transfer_split without timeout got %v", err)
+	}
+	c = New(Config{Transport: slowTransport{time.Millisecond * 50}, SendTimeout: time.Millisecond * 10})
+	if err := c.Do("relay_tx", nil, &GetHeightResponse{}); !IsOutcomeUnknown(err) {
+		t.Errorf("Wanted relay_tx outcome unknown got %v", err)
+	}
+}
+
+func TestRPCError(t *testing.T) {
+	tables := []struct {
+		body string
+		code int
+		outs bool
+	}{
+		{`{"id":1,"jsonrpc":"2.0","error":{"code":-19,"message":"not enough outputs to mix"}}`, ErrCodeNotEnoughOutsToMix, true},
+		{`{"id":1,"jsonrpc":"2.0","error":{"code":-4,"message":"failed to get random outs to mix"}}`, ErrCodeGenericTransfer, true},
+		{`{"id":1,"jsonrpc":"2.0","error":{"code":-17,"message":"not enough money"}}`, ErrCodeNotEnoughMoney, false},
+	}
+	for _, table := range tables {
+		c := New(Config{Transport: &flakyTransport{body: table.body}})
+		_, err := c.TransferSplit(&TransferSplitRequest{})
+		if ErrorCode(err) != table.code || IsOutsError(err) != table.outs {
+			t.Errorf("wanted code %d outs %v got %v", table.code, table.outs, err)
+		}
+	}
+}
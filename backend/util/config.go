@@ -2,7 +2,14 @@ package util
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/namsral/flag"
 
@@ -10,29 +17,69 @@ import (
 )
 
 type config struct {
-	Bind          string
-	MaintAddress  string
-	FundAddress   string
-	RpcUser       string
-	RpcPass       string
-	RpcAddress    string
-	DaemonUser    string
-	DaemonPass    string
-	DaemonAddress string
-	DataPath      string
-	DbName        string
-	Production    bool
-	SMTPHost      string
-	SMTPPort      string
-	SMTPUser      string
-	SMTPPass      string
-	ContactEmail  string
-	LogFile       string
-	AdminKey      string
+	Bind           string
+	MaintAddress   string
+	FundAddress    string
+	RpcUser        string
+	RpcPass        string
+	RpcAddress     string
+	DaemonUser     string
+	DaemonPass     string
+	DaemonAddress  string
+	RpcTimeout     time.Duration
+	RpcSendTimeout time.Duration
+	DaemonQuorum   int
+	DaemonSchedule string
+	HealthMaxLag   int
+	HealthScanAge  time.Duration
+	HealthPriceAge time.Duration
+	RpcRetries     int
+	DataPath       string
+	DbName         string
+	Production     bool
+	SMTPHost       string
+	SMTPPort       string
+	SMTPUser       string
+	SMTPPass       string
+	ContactEmail   string
+	LogFile        string
+	LogLevel       string
+	LogFormat      string
+	AdminKey       string
+	PrizeTiers     string
+	Split          Split
+	PriceSchedule  string
+	Currency       string
+	TicketPrice    float64
+	EntryPiconero  uint64
+	PriceSources   string
+	PriceStatic    float64
+	PriceDeviation float64
+	PriceGrace     time.Duration
+	MissedSchedule string
+	BackupSchedule string
+	PayoutSchedule string
+
+	PayoutConfirmations uint64
+	PayoutStuckAfter    time.Duration
+	PayoutApproval      bool
+	ViewOnly            bool
+}
+
+// Split is how the pot is distributed in percentages, FeeReserve is kept in the wallet for fees
+type Split struct {
+	Winner      float64   `json:"winner"`
+	Tiers       []float64 `json:"tiers"`
+	Referrals   float64   `json:"referrals"`
+	Maintenance float64   `json:"maintenance"`
+	Fund        float64   `json:"fund"`
+	FeeReserve  uint64    `json:"fee_reserve"`
 }
 
 var (
 	Config = config{}
+
+	validCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
 )
 
 func ParseArgs() {
@@ -42,9 +89,17 @@ func ParseArgs() {
 	flag.StringVar(&Config.RpcAddress, "rpc-address", "http://localhost:18082/json_rpc", "monero wallet rpc address")
 	flag.StringVar(&Config.RpcUser, "rpc-user", "", "monero wallet rpc username")
 	flag.StringVar(&Config.RpcPass, "rpc-pass", "", "monero wallet rpc password")
-	flag.StringVar(&Config.DaemonAddress, "daemon-address", "http://localhost:28081/json_rpc", "monero daemon rpc address")
+	flag.StringVar(&Config.DaemonAddress, "daemon-address", "http://localhost:28081/json_rpc", "monero daemon rpc addresses, comma separated in failover order")
+	flag.IntVar(&Config.DaemonQuorum, "daemon-quorum", 2, "daemons that must agree on the first block of a draw, at most the number of daemons")
+	flag.IntVar(&Config.HealthMaxLag, "health-max-lag", 10, "blocks the wallet can be behind the daemon before /readyz fails")
+	flag.DurationVar(&Config.HealthScanAge, "health-scan-age", time.Hour*2, "time since incoming transfers were last checked before /readyz fails")
+	flag.DurationVar(&Config.HealthPriceAge, "health-price-age", time.Hour*48, "age of the entry price before /readyz fails")
+	flag.StringVar(&Config.DaemonSchedule, "daemon-schedule", "* * * * *", "schedule of the daemon health checks when there's more than one")
 	flag.StringVar(&Config.DaemonUser, "daemon-user", "", "monero daemon rpc username")
 	flag.StringVar(&Config.DaemonPass, "daemon-pass", "", "monero daemon rpc password")
+	flag.DurationVar(&Config.RpcTimeout, "rpc-timeout", time.Minute*2, "timeout of a wallet or daemon rpc call")
+	flag.DurationVar(&Config.RpcSendTimeout, "rpc-send-timeout", time.Minute*30, "timeout of a transfer or relay rpc call, 0 waits as long as the wallet takes")
+	flag.IntVar(&Config.RpcRetries, "rpc-retries", 3, "retries of a wallet or daemon rpc call on connection errors, transfers are never retried")
 	flag.StringVar(&Config.DataPath, "data-path", "./data", "db storage")
 	flag.StringVar(&Config.DbName, "db-name", "data.db", "db filename")
 	flag.StringVar(&Config.SMTPHost, "smtp-host", "smtp.privatemail.com", "SMTP host")
@@ -52,23 +107,141 @@ func ParseArgs() {
 	flag.StringVar(&Config.SMTPUser, "smtp-user", "", "SMTP username")
 	flag.StringVar(&Config.SMTPPass, "smtp-pass", "", "SMTP password")
 	flag.StringVar(&Config.LogFile, "log-file", "", "Log file")
+	flag.StringVar(&Config.LogLevel, "log-level", "", "debug, info, warn or error, defaults to info in production and debug otherwise")
+	flag.StringVar(&Config.LogFormat, "log-format", "logfmt", "logfmt or json")
 	flag.StringVar(&Config.AdminKey, "admin-key", "abc123", "Admin key for auth stuff")
 	flag.StringVar(&Config.ContactEmail, "contact-email", "support@moneropot.org", "Contact email")
+	flag.Float64Var(&Config.Split.Winner, "split-winner", 70, "percentage of the pot to the winners")
+	flag.Float64Var(&Config.Split.Referrals, "split-referrals", 15, "percentage of the pot to referrals")
+	flag.Float64Var(&Config.Split.Maintenance, "split-maintenance", 10, "percentage of the pot to the maintenance address")
+	flag.Float64Var(&Config.Split.Fund, "split-fund", 5, "percentage of the pot to the fund address")
+	flag.Uint64Var(&Config.Split.FeeReserve, "fee-reserve", 1e12, "piconero kept in the wallet for transfer fees")
+	flag.StringVar(&Config.PrizeTiers, "prize-tiers", "", "comma separated percentages of the pot for 1st, 2nd, ... prize, must add up to split-winner")
+	flag.StringVar(&Config.PriceSchedule, "price-schedule", "0 3 * * *", "cron expression (UTC) for the entry price update")
+	flag.StringVar(&Config.Currency, "currency", "USD", "fiat currency of the ticket price, the price sources are asked for XMR in it")
+	flag.Float64Var(&Config.TicketPrice, "ticket-price", 2.5, "price of an entry in the fiat currency")
+	flag.Uint64Var(&Config.EntryPiconero, "entry-piconero", 0, "fixed entry price in piconero, no price sources or fiat currency are used when set")
+	flag.StringVar(&Config.PriceSources, "price-sources", "tradeogre,kraken,coingecko,bitfinex", "comma separated XMR/USD sources out of tradeogre, kraken, coingecko, bitfinex and static")
+	flag.Float64Var(&Config.PriceStatic, "price-static", 0, "XMR rate in the fiat currency of the static price source")
+	flag.Float64Var(&Config.PriceDeviation, "price-max-deviation", 10, "percent a source can be away from the median before it's left out")
+	flag.DurationVar(&Config.PriceGrace, "price-grace", time.Minute*20, "a transfer gets the lowest entry price of this long before its block time")
+	flag.StringVar(&Config.MissedSchedule, "missed-schedule", "0 * * * *", "cron expression (UTC) for the missed transfers check")
+	flag.StringVar(&Config.BackupSchedule, "backup-schedule", "30 23 * * *", "cron expression (UTC) for the db backup")
+	flag.StringVar(&Config.PayoutSchedule, "payout-schedule", "*/10 * * * *", "cron expression (UTC) for checking sent payouts")
+	flag.Uint64Var(&Config.PayoutConfirmations, "payout-confirmations", 10, "confirmations for a payout to be confirmed")
+	flag.DurationVar(&Config.PayoutStuckAfter, "payout-stuck-after", time.Hour*2, "notify when a payout is still unconfirmed after this long")
+	flag.BoolVar(&Config.PayoutApproval, "payout-approval", false, "build payouts without relaying them until an admin approves")
+	flag.BoolVar(&Config.ViewOnly, "view-only", false, "wallet rpc is view-only, payouts are exported unsigned and signed offline")
 	flag.BoolVar(&Config.Production, "production", false, "running in production")
 	flag.Parse()
+	setupLog()
 	if Config.MaintAddress == "" {
-		log.Fatal(fmt.Errorf("no maintenance address provided"))
+		Log.Fatal("no maintenance address provided")
 	} else if len(Config.MaintAddress) != 95 {
-		log.Fatal(fmt.Errorf("invalid maintenance address provided"))
+		Log.Fatal("invalid maintenance address provided")
 	}
+	if err := Config.Split.parse(Config.PrizeTiers); err != nil {
+		Log.Fatal("invalid split", "error", err)
+	}
+	if err := parsePricing(); err != nil {
+		Log.Fatal("invalid pricing", "error", err)
+	}
+}
 
+// parsePricing checks the fiat pricing and sets the price sources, a fixed entry price uses none of it
+func parsePricing() error {
+	if FixedPrice() {
+		Prices = nil
+		return nil
+	}
+	Config.Currency = strings.ToUpper(Config.Currency)
+	if !validCurrency.MatchString(Config.Currency) {
+		return fmt.Errorf("currency %q isn't a 3 letter code like USD or EUR", Config.Currency)
+	}
+	if Config.TicketPrice <= 0 {
+		return fmt.Errorf("ticket price must be positive")
+	}
+	return parsePriceSources(Config.PriceSources)
+}
+
+// setupLog writes the structured logs and anything still using the standard logger to
+// the rotated log file when there is one
+func setupLog() {
+	var w io.Writer = os.Stderr
 	if Config.LogFile != "" {
-		log.SetOutput(&lumberjack.Logger{
+		w = &lumberjack.Logger{
 			Filename:   Config.LogFile,
 			MaxSize:    50,
 			MaxBackups: 2,
 			MaxAge:     30,
 			Compress:   true,
-		})
+		}
+	}
+	log.SetOutput(w)
+	level := LevelDebug
+	if Config.Production {
+		level = LevelInfo
+	}
+	if Config.LogLevel != "" {
+		var err error
+		if level, err = ParseLevel(Config.LogLevel); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := SetupLog(w, Config.LogFormat, level); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parse sets the prize tiers and validates the split adds up to 100%
+func (s *Split) parse(prizeTiers string) error {
+	if prizeTiers == "" {
+		prizeTiers = strconv.FormatFloat(s.Winner, 'f', -1, 64)
+	}
+	tiers, err := parsePercents(prizeTiers)
+	if err != nil {
+		return fmt.Errorf("prize tiers %v", err)
+	}
+	if !sameTotal(tiers, s.Winner) {
+		return fmt.Errorf("prize tiers must add up to %v", s.Winner)
+	}
+	s.Tiers = tiers
+	for _, p := range []float64{s.Winner, s.Referrals, s.Maintenance, s.Fund} {
+		if p < 0 {
+			return fmt.Errorf("percentages can't be negative")
+		}
+	}
+	if !sameTotal([]float64{s.Winner, s.Referrals, s.Maintenance, s.Fund}, 100) {
+		return fmt.Errorf("winner, referrals, maintenance and fund must add up to 100")
+	}
+	return nil
+}
+
+// Percent returns the pct share of amount
+func Percent(amount float64, pct float64) uint64 {
+	return uint64(amount * pct / 100)
+}
+
+// parsePercents parses "50,15,5" percentages, 0 is allowed for a share that isn't paid
+func parsePercents(s string) ([]float64, error) {
+	var percents []float64
+	for _, v := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, err
+		}
+		if p < 0 || math.IsNaN(p) {
+			return nil, fmt.Errorf("percentage can't be negative got %s", v)
+		}
+		percents = append(percents, p)
+	}
+	return percents, nil
+}
+
+func sameTotal(percents []float64, total float64) bool {
+	var sum float64
+	for _, p := range percents {
+		sum += p
 	}
+	return math.Abs(sum-total) < 1e-9
 }
@@ -0,0 +1,210 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Level orders log lines, lines below the configured level are dropped
+	Level int
+
+	// Logger writes leveled lines with key value fields in logfmt or json,
+	// loggers made by With share the output of the root logger
+	Logger struct {
+		out    *logOutput
+		fields []interface{}
+	}
+
+	logOutput struct {
+		mu     sync.Mutex
+		w      io.Writer
+		json   bool
+		level  Level
+		exit   func(code int)
+		buffer bytes.Buffer
+	}
+
+	logKey struct{}
+)
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var (
+	// Log is the root logger, components add their fields with Log.With
+	Log = &Logger{out: &logOutput{w: os.Stderr, level: LevelInfo, exit: os.Exit}}
+
+	levelNames = []string{"debug", "info", "warn", "error"}
+)
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// SetupLog points every logger at w, format is logfmt or json
+func SetupLog(w io.Writer, format string, level Level) error {
+	if format != "logfmt" && format != "json" {
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	Log.out.mu.Lock()
+	defer Log.out.mu.Unlock()
+	Log.out.w = w
+	Log.out.json = format == "json"
+	Log.out.level = level
+	return nil
+}
+
+// With returns a logger adding the key value pairs to every line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+// Enabled tells if lines at the level are written
+func (l *Logger) Enabled(level Level) bool {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.write(LevelDebug, msg, kv)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.write(LevelInfo, msg, kv)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.write(LevelWarn, msg, kv)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.write(LevelError, msg, kv)
+}
+
+// Fatal logs at error level and exits
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.write(LevelError, msg, kv)
+	l.out.exit(1)
+}
+
+func (l *Logger) write(level Level, msg string, kv []interface{}) {
+	o := l.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if level < o.level {
+		return
+	}
+	fields := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	fields = append(fields, "time", UtcNow().Format(time.RFC3339), "level", level.String(), "msg", msg)
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "!MISSING")
+	}
+	b := &o.buffer
+	b.Reset()
+	if o.json {
+		writeJSONFields(b, fields)
+	} else {
+		writeLogfmtFields(b, fields)
+	}
+	b.WriteByte('\n')
+	o.w.Write(b.Bytes())
+}
+
+func writeLogfmtFields(b *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteByte('=')
+		v := logValue(fields[i+1])
+		if v == "" || strings.ContainsAny(v, " =\"\\\n\t") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+}
+
+func writeJSONFields(b *bytes.Buffer, fields []interface{}) {
+	b.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(fmt.Sprint(fields[i]))
+		b.Write(k)
+		b.WriteByte(':')
+		var v []byte
+		switch fields[i+1].(type) {
+		case bool, int, int64, uint64, uint, float64:
+			v, _ = json.Marshal(fields[i+1])
+		default:
+			v, _ = json.Marshal(logValue(fields[i+1]))
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+}
+
+func logValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return t
+	case error:
+		return t.Error()
+	case time.Time:
+		return t.UTC().Format(time.RFC3339)
+	case time.Duration:
+		return t.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// WithLogger carries the logger in ctx, api requests carry one with their request id
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, logKey{}, l)
+}
+
+// LogFrom returns the logger carried by ctx or the root logger
+func LogFrom(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(logKey{}).(*Logger); ok {
+			return l
+		}
+	}
+	return Log
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	now := Now
+	Now = func() time.Time {
+		return time.Date(2021, 11, 20, 10, 30, 0, 0, time.UTC)
+	}
+	defer func() {
+		Now = now
+		SetupLog(os.Stderr, "logfmt", LevelInfo)
+	}()
+	l := Log.With("component", "test", "pot_id", 1)
+	tests := []struct {
+		format string
+		level  Level
+		log    func()
+		want   string
+	}{
+		{"logfmt", LevelInfo, func() { l.Info("found transfers", "txid", "abc", "height", 10) },
+			`time=2021-11-20T10:30:00Z level=info msg="found transfers" component=test pot_id=1 txid=abc height=10` + "\n"},
+		{"logfmt", LevelInfo, func() { l.Debug("hidden") }, ""},
+		{"logfmt", LevelDebug, func() { l.Debug("shown", "took", time.Second) },
+			`time=2021-11-20T10:30:00Z level=debug msg=shown component=test pot_id=1 took=1s` + "\n"},
+		{"logfmt", LevelError, func() { l.Warn("hidden") }, ""},
+		{"logfmt", LevelInfo, func() { l.Error("failed", "error", fmt.Errorf(`bad "x"`), "empty", "") },
+			`time=2021-11-20T10:30:00Z level=error msg=failed component=test pot_id=1 error="bad \"x\"" empty=""` + "\n"},
+		{"logfmt", LevelInfo, func() { l.Info("odd", "key") },
+			`time=2021-11-20T10:30:00Z level=info msg=odd component=test pot_id=1 key=!MISSING` + "\n"},
+		{"json", LevelInfo, func() { l.Warn("switched", "daemon", "node1", "ok", true) },
+			`{"time":"2021-11-20T10:30:00Z","level":"warn","msg":"switched","component":"test","pot_id":1,"daemon":"node1","ok":true}` + "\n"},
+		{"json", LevelInfo, func() {
+			LogFrom(WithLogger(context.Background(), Log.With("request_id", "r1"))).Info("request")
+		}, `{"time":"2021-11-20T10:30:00Z","level":"info","msg":"request","request_id":"r1"}` + "\n"},
+		{"json", LevelInfo, func() { LogFrom(context.Background()).Info("root") },
+			`{"time":"2021-11-20T10:30:00Z","level":"info","msg":"root"}` + "\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := SetupLog(&b, tt.format, tt.level); err != nil {
+			t.Fatalf("Wanted no error got %v", err)
+		}
+		tt.log()
+		if got := b.String(); got != tt.want {
+			t.Errorf("Wanted %q got %q", tt.want, got)
+		}
+	}
+
+	if err := SetupLog(os.Stderr, "xml", LevelInfo); err == nil {
+		t.Errorf("Wanted error for unknown format")
+	}
+	for _, s := range []string{"debug", "INFO", "warn", "error"} {
+		if _, err := ParseLevel(s); err != nil {
+			t.Errorf("Wanted no error for %s got %v", s, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("Wanted error for verbose")
+	}
+}
@@ -0,0 +1,196 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// metric is one family in the prometheus text format, values are keyed by their label values
+	metric struct {
+		name    string
+		help    string
+		kind    string
+		labels  []string
+		buckets []float64
+
+		mu     sync.Mutex
+		values map[string]*metricValue
+	}
+
+	metricValue struct {
+		labels []string
+		value  float64
+		counts []uint64
+		sum    float64
+		count  uint64
+	}
+
+	Counter struct{ m *metric }
+	Gauge   struct{ m *metric }
+
+	Histogram struct{ m *metric }
+)
+
+var (
+	metrics    []*metric
+	metricsMu  sync.Mutex
+	collectors []func()
+
+	// DefaultBuckets are in seconds from 5ms to 10s
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	SSEClients   = NewGauge("moneropot_sse_clients", "Connected /api/events clients.")
+	EmailsSent   = NewCounter("moneropot_emails_sent_total", "Event emails sent.")
+	EmailsFailed = NewCounter("moneropot_emails_failed_total", "Event emails that failed to send.")
+)
+
+func newMetric(name string, help string, kind string, labels []string) *metric {
+	m := &metric{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]*metricValue),
+	}
+	metricsMu.Lock()
+	metrics = append(metrics, m)
+	metricsMu.Unlock()
+	return m
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{newMetric(name, help, "counter", labels)}
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{newMetric(name, help, "gauge", labels)}
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	m := newMetric(name, help, "histogram", labels)
+	m.buckets = buckets
+	return &Histogram{m}
+}
+
+// RegisterCollector runs collect before every scrape, for gauges that are read rather than updated
+func RegisterCollector(collect func()) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	collectors = append(collectors, collect)
+}
+
+// value needs mu
+func (m *metric) value(labels []string) *metricValue {
+	if len(labels) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s wants labels %v got %v", m.name, m.labels, labels))
+	}
+	key := strings.Join(labels, "\xff")
+	v, ok := m.values[key]
+	if !ok {
+		v = &metricValue{labels: labels}
+		if m.buckets != nil {
+			v.counts = make([]uint64, len(m.buckets))
+		}
+		m.values[key] = v
+	}
+	return v
+}
+
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *Counter) Add(n float64, labels ...string) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.m.value(labels).value += n
+}
+
+func (g *Gauge) Set(n float64, labels ...string) {
+	g.m.mu.Lock()
+	defer g.m.mu.Unlock()
+	g.m.value(labels).value = n
+}
+
+func (h *Histogram) Observe(n float64, labels ...string) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	v := h.m.value(labels)
+	for i, le := range h.m.buckets {
+		if n <= le {
+			v.counts[i]++
+		}
+	}
+	v.sum += n
+	v.count++
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	var parts []string
+	for i, name := range names {
+		parts = append(parts, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+extra[i+1]+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(n float64) string {
+	if math.IsInf(n, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// WriteMetrics writes every metric in the prometheus text format
+func WriteMetrics(w io.Writer) {
+	metricsMu.Lock()
+	all := append([]*metric{}, metrics...)
+	collect := append([]func(){}, collectors...)
+	metricsMu.Unlock()
+	for _, c := range collect {
+		c()
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+	for _, m := range all {
+		m.write(w)
+	}
+}
+
+func (m *metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := m.values[k]
+		if m.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(m.labels, v.labels), formatFloat(v.value))
+			continue
+		}
+		for i, le := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatLabels(m.labels, v.labels, "le", formatFloat(le)), v.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatLabels(m.labels, v.labels, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, formatLabels(m.labels, v.labels), formatFloat(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, formatLabels(m.labels, v.labels), v.count)
+	}
+}
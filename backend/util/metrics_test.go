@@ -0,0 +1,40 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	c := NewCounter("test_calls_total", "Test calls.", "method")
+	g := NewGauge("test_balance", "Test balance.")
+	h := NewHistogram("test_seconds", "Test latency.", []float64{0.1, 1}, "method")
+	c.Inc(`get "x"`)
+	c.Add(2, `get "x"`)
+	g.Set(1.5)
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(5, "a")
+	RegisterCollector(func() {
+		g.Set(2.5)
+	})
+	var b bytes.Buffer
+	WriteMetrics(&b)
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE test_calls_total counter\n",
+		`test_calls_total{method="get \"x\""} 3` + "\n",
+		"test_balance 2.5\n",
+		"# TYPE test_seconds histogram\n",
+		`test_seconds_bucket{method="a",le="0.1"} 1` + "\n",
+		`test_seconds_bucket{method="a",le="1"} 2` + "\n",
+		`test_seconds_bucket{method="a",le="+Inf"} 3` + "\n",
+		`test_seconds_sum{method="a"} 5.55` + "\n",
+		`test_seconds_count{method="a"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Wanted %q in\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// PriceSource quotes XMR in a fiat currency with 8 decimals like XmrPrice
+	PriceSource interface {
+		Name() string
+		XmrRate(currency string) (uint64, error)
+	}
+
+	// Quote is the answer of a source, Outlier is set when it was left out of the median
+	Quote struct {
+		Source  string `json:"source"`
+		Price   uint64 `json:"price"`
+		Error   string `json:"error,omitempty"`
+		Outlier bool   `json:"outlier,omitempty"`
+	}
+
+	// jsonSource reads the price from the json of an exchange ticker, url has the currency
+	// in place of %s, lower case when lower is set
+	jsonSource struct {
+		name  string
+		url   string
+		lower bool
+		parse func(currency string, get func(dst interface{}) error) (float64, error)
+	}
+
+	tradeOgreSource struct{}
+
+	// StaticPrice is a fixed XMR rate in the configured currency, the manual source when the
+	// exchanges can't be used
+	StaticPrice float64
+)
+
+var (
+	lastPriceUpdate time.Time
+	// XmrPrice is XMR in Config.Currency
+	XmrPrice  uint64
+	priceLock sync.Mutex
+
+	// Prices are the configured sources, set from -price-sources
+	Prices = []PriceSource{tradeOgreSource{}}
+
+	ErrFixedPrice = fmt.Errorf("fixed entry price, no price sources")
+)
+
+// FixedPrice is set when the entry price is -entry-piconero instead of a fiat price
+func FixedPrice() bool {
+	return Config.EntryPiconero > 0
+}
+
+// NewPriceSource returns the source by name, static uses -price-static
+func NewPriceSource(name string) (PriceSource, error) {
+	switch name {
+	case "tradeogre":
+		return tradeOgreSource{}, nil
+	case "kraken":
+		return &jsonSource{name: name, url: "https://api.kraken.com/0/public/Ticker?pair=XMR%s", parse: parseKraken}, nil
+	case "coingecko":
+		return &jsonSource{name: name, url: "https://api.coingecko.com/api/v3/simple/price?ids=monero&vs_currencies=%s", lower: true, parse: parseCoinGecko}, nil
+	case "bitfinex":
+		return &jsonSource{name: name, url: "https://api-pub.bitfinex.com/v2/ticker/tXMR%s", parse: parseBitfinex}, nil
+	case "static":
+		if Config.PriceStatic <= 0 {
+			return nil, fmt.Errorf("static price source needs -price-static")
+		}
+		return StaticPrice(Config.PriceStatic), nil
+	}
+	return nil, fmt.Errorf("unknown price source %q", name)
+}
+
+// parsePriceSources sets Prices from a comma separated list of names
+func parsePriceSources(names string) error {
+	var sources []PriceSource
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		s, err := NewPriceSource(name)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, s)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no price sources")
+	}
+	Prices = sources
+	return nil
+}
+
+// FiatCurrency is the configured currency, USD when it isn't set
+func FiatCurrency() string {
+	if Config.Currency == "" {
+		return "USD"
+	}
+	return Config.Currency
+}
+
+func fiatPrice(rate float64) (uint64, error) {
+	if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("invalid price %v", rate)
+	}
+	return uint64(math.Round(rate * 1e8)), nil
+}
+
+func (s *jsonSource) Name() string {
+	return s.name
+}
+
+func (s *jsonSource) XmrRate(currency string) (uint64, error) {
+	if s.lower {
+		currency = strings.ToLower(currency)
+	}
+	rate, err := s.parse(currency, func(dst interface{}) error {
+		return GetURL(fmt.Sprintf(s.url, currency), dst)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return fiatPrice(rate)
+}
+
+func parseKraken(currency string, get func(dst interface{}) error) (float64, error) {
+	resp := &struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			// last trade closed [price, lot volume]
+			C []string `json:"c"`
+		} `json:"result"`
+	}{}
+	if err := get(resp); err != nil {
+		return 0, err
+	}
+	if len(resp.Error) > 0 {
+		return 0, fmt.Errorf("kraken error %s", strings.Join(resp.Error, ", "))
+	}
+	for _, ticker := range resp.Result {
+		if len(ticker.C) > 0 {
+			return strconv.ParseFloat(ticker.C[0], 64)
+		}
+	}
+	return 0, fmt.Errorf("kraken no ticker")
+}
+
+func parseCoinGecko(currency string, get func(dst interface{}) error) (float64, error) {
+	resp := map[string]map[string]float64{}
+	if err := get(&resp); err != nil {
+		return 0, err
+	}
+	rate, ok := resp["monero"][currency]
+	if !ok {
+		return 0, fmt.Errorf("coingecko no %s price", currency)
+	}
+	return rate, nil
+}
+
+func parseBitfinex(currency string, get func(dst interface{}) error) (float64, error) {
+	var resp []float64
+	if err := get(&resp); err != nil {
+		return 0, err
+	}
+	// bid, bid size, ask, ask size, daily change, daily change relative, last price, ...
+	if len(resp) < 7 {
+		return 0, fmt.Errorf("bitfinex no ticker")
+	}
+	return resp[6], nil
+}
+
+func (tradeOgreSource) Name() string {
+	return "tradeogre"
+}
+
+// XmrRate goes through bitcoin, tradeogre has no fiat market for monero and only tether for bitcoin
+func (tradeOgreSource) XmrRate(currency string) (uint64, error) {
+	if currency != "USD" {
+		return 0, fmt.Errorf("tradeogre only quotes USD")
+	}
+	var (
+		wg             sync.WaitGroup
+		btcUSD, xmrBTC float64
+		errBTC, errXMR error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		btcUSD, errBTC = PriceMarket("BTC-USDT")
+	}()
+	go func() {
+		defer wg.Done()
+		xmrBTC, errXMR = PriceMarket("XMR-BTC")
+	}()
+	wg.Wait()
+	if errBTC != nil {
+		return 0, fmt.Errorf("btc price error %v", errBTC)
+	}
+	if errXMR != nil {
+		return 0, fmt.Errorf("xmr price error %v", errXMR)
+	}
+	return fiatPrice(btcUSD * xmrBTC)
+}
+
+func (s StaticPrice) Name() string {
+	return "static"
+}
+
+func (s StaticPrice) XmrRate(currency string) (uint64, error) {
+	return fiatPrice(float64(s))
+}
+
+func PriceMarket(market string) (float64, error) {
+	type response struct {
+		Success bool   `json:"success"`
+		Price   string `json:"price"`
+	}
+	resp := &response{}
+	if err := GetURL("https://tradeogre.com/api/v1/ticker/"+market, resp); err != nil {
+		return 0, err
+	}
+	if !resp.Success {
+		return 0, fmt.Errorf("PriceMarket: failed to get %s", market)
+	}
+	price, err := strconv.ParseFloat(resp.Price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("PriceMarket: parseFloat error %v", err)
+	}
+	return price, nil
+}
+
+func median(prices []uint64) uint64 {
+	sorted := append([]uint64(nil), prices...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// MedianPrice is the median of the quotes that answered after dropping the ones more than
+// maxDeviation percent away from the median of all of them, dropped quotes are marked Outlier
+func MedianPrice(quotes []Quote, maxDeviation float64) (uint64, error) {
+	var prices []uint64
+	for _, q := range quotes {
+		if q.Error == "" {
+			prices = append(prices, q.Price)
+		}
+	}
+	if len(prices) == 0 {
+		return 0, fmt.Errorf("no price source answered")
+	}
+	m := float64(median(prices))
+	var kept []uint64
+	for i := range quotes {
+		if quotes[i].Error != "" {
+			continue
+		}
+		if math.Abs(float64(quotes[i].Price)-m)/m*100 > maxDeviation {
+			quotes[i].Outlier = true
+			continue
+		}
+		kept = append(kept, quotes[i].Price)
+	}
+	if len(kept) == 0 {
+		return 0, fmt.Errorf("price sources disagree by more than %v%%", maxDeviation)
+	}
+	return median(kept), nil
+}
+
+// FetchPrice asks every source for the configured currency at once and sets XmrPrice to the
+// median, the quotes are returned even when no price could be chosen so failures can be kept
+func FetchPrice() (uint64, []Quote, error) {
+	if FixedPrice() {
+		return 0, nil, ErrFixedPrice
+	}
+	currency := FiatCurrency()
+	quotes := make([]Quote, len(Prices))
+	var wg sync.WaitGroup
+	for i, s := range Prices {
+		wg.Add(1)
+		go func(i int, s PriceSource) {
+			defer wg.Done()
+			quotes[i].Source = s.Name()
+			p, err := s.XmrRate(currency)
+			if err != nil {
+				quotes[i].Error = err.Error()
+				return
+			}
+			quotes[i].Price = p
+		}(i, s)
+	}
+	wg.Wait()
+	price, err := MedianPrice(quotes, Config.PriceDeviation)
+	if err != nil {
+		return 0, quotes, fmt.Errorf("FetchPrice error %v", err)
+	}
+	priceLock.Lock()
+	XmrPrice = price
+	lastPriceUpdate = time.Now()
+	priceLock.Unlock()
+	return price, quotes, nil
+}
+
+// XmrToFiat is the median XMR price in the configured currency, cached for 5 minutes unless forced
+func XmrToFiat(force bool) (uint64, error) {
+	priceLock.Lock()
+	cached := XmrPrice
+	fresh := time.Since(lastPriceUpdate).Minutes() <= 5
+	priceLock.Unlock()
+	if !force && cached > 0 && fresh {
+		return cached, nil
+	}
+	price, _, err := FetchPrice()
+	if err != nil {
+		return 0, fmt.Errorf("XmrToFiat error %v", err)
+	}
+	return price, nil
+}
+
+// SetXmrPrice is the last known rate when the sources can't be reached
+func SetXmrPrice(price uint64) {
+	priceLock.Lock()
+	defer priceLock.Unlock()
+	if XmrPrice == 0 {
+		XmrPrice = price
+	}
+}
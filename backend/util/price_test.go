@@ -0,0 +1,82 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMedianPrice(t *testing.T) {
+	tests := []struct {
+		quotes   []Quote
+		want     uint64
+		outliers []string
+		err      bool
+	}{
+		{[]Quote{{Source: "a", Price: 100}}, 100, nil, false},
+		{[]Quote{{Source: "a", Price: 100}, {Source: "b", Price: 104}}, 102, nil, false},
+		{[]Quote{{Source: "a", Price: 100}, {Source: "b", Price: 102}, {Source: "c", Price: 200}}, 101, []string{"c"}, false},
+		{[]Quote{{Source: "a", Price: 100}, {Source: "b", Error: "down"}, {Source: "c", Price: 98}, {Source: "d", Price: 1}}, 99, []string{"d"}, false},
+		{[]Quote{{Source: "a", Price: 100}, {Source: "b", Price: 300}}, 0, []string{"a", "b"}, true},
+		{[]Quote{{Source: "a", Error: "down"}}, 0, nil, true},
+		{nil, 0, nil, true},
+	}
+	for i, tt := range tests {
+		got, err := MedianPrice(tt.quotes, 10)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%d wanted %d error %v got %d %v", i, tt.want, tt.err, got, err)
+		}
+		var outliers []string
+		for _, q := range tt.quotes {
+			if q.Outlier {
+				outliers = append(outliers, q.Source)
+			}
+		}
+		if len(outliers) != len(tt.outliers) {
+			t.Errorf("%d wanted outliers %v got %v", i, tt.outliers, outliers)
+		}
+	}
+}
+
+func TestPriceSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		path     string
+		body     string
+		want     uint64
+	}{
+		{"kraken", "USD", "/USD", `{"error":[],"result":{"XXMRZUSD":{"a":["160.1","1"],"c":["160.12345678","0.5"]}}}`, 16012345678},
+		{"kraken", "EUR", "/EUR", `{"error":[],"result":{"XXMRZEUR":{"c":["140.5","0.5"]}}}`, 14050000000},
+		{"coingecko", "USD", "/usd", `{"monero":{"usd":159.5}}`, 15950000000},
+		{"coingecko", "EUR", "/eur", `{"monero":{"eur":139.25}}`, 13925000000},
+		{"bitfinex", "USD", "/USD", `[159,10,160,12,1.5,0.01,159.75,1000,165,150]`, 15975000000},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != tt.path {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(tt.body))
+		}))
+		s, err := NewPriceSource(tt.name)
+		if err != nil {
+			t.Fatalf("%s wanted no error got %v", tt.name, err)
+		}
+		s.(*jsonSource).url = srv.URL + "/%s"
+		if got, err := s.XmrRate(tt.currency); err != nil || got != tt.want {
+			t.Errorf("%s %s wanted %d got %d %v", tt.name, tt.currency, tt.want, got, err)
+		}
+		srv.Close()
+	}
+	if _, err := NewPriceSource("static"); err == nil {
+		t.Errorf("Wanted error for static without a price")
+	}
+	if _, err := (tradeOgreSource{}).XmrRate("EUR"); err == nil {
+		t.Errorf("Wanted error for tradeogre in EUR")
+	}
+	if _, err := NewPriceSource("nope"); err == nil {
+		t.Errorf("Wanted error for unknown source")
+	}
+}
@@ -1,7 +1,6 @@
 package util
 
 import (
-	"log"
 	"net/smtp"
 
 	"github.com/domodwyer/mailyak"
@@ -14,6 +13,11 @@ func init() {
 
 var (
 	eventJobs = make(chan string, 50)
+
+	// EventQueue persists events so failed emails are retried, events are only mailed directly without it
+	EventQueue func(msg string) error
+
+	eventLog = Log.With("component", "events")
 )
 
 func SendEvent(msg string) {
@@ -23,19 +27,35 @@ func SendEvent(msg string) {
 func sendEvents() {
 
 	for event := range eventJobs {
-		if Config.Production {
-			mail := mailyak.New(Config.SMTPHost+":"+Config.SMTPPort, smtp.PlainAuth(Config.SMTPUser, Config.SMTPUser, Config.SMTPPass, Config.SMTPHost))
-			mail.Plain().Set(event)
-			mail.Subject("Monero Pot Event")
-			mail.To(Config.ContactEmail)
-			mail.From(Config.SMTPUser)
-			if err := mail.Send(); err != nil {
-				log.Println("Failed send event", event)
-				eventJobs <- event
+		if EventQueue != nil {
+			if err := EventQueue(event); err == nil {
+				continue
+			} else {
+				eventLog.Error("queue event failed", "error", err)
 			}
-		} else {
-			log.Println("SendEvent", event)
+		}
+		if err := MailEvent(event); err != nil {
+			eventLog.Error("send event failed", "event", event, "error", err)
 		}
 	}
 
 }
+
+// MailEvent emails the event to the contact email, outside production it's only logged
+func MailEvent(event string) error {
+	if !Config.Production {
+		eventLog.Info("event", "event", event)
+		return nil
+	}
+	mail := mailyak.New(Config.SMTPHost+":"+Config.SMTPPort, smtp.PlainAuth(Config.SMTPUser, Config.SMTPUser, Config.SMTPPass, Config.SMTPHost))
+	mail.Plain().Set(event)
+	mail.Subject("Monero Pot Event")
+	mail.To(Config.ContactEmail)
+	mail.From(Config.SMTPUser)
+	if err := mail.Send(); err != nil {
+		EmailsFailed.Inc()
+		return err
+	}
+	EmailsSent.Inc()
+	return nil
+}
@@ -2,7 +2,6 @@ package util
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 )
@@ -23,7 +22,10 @@ type (
 	}
 )
 
-var broker *Broker
+var (
+	broker *Broker
+	sseLog = Log.With("component", "sse")
+)
 
 const patience time.Duration = time.Second * 1
 
@@ -49,9 +51,7 @@ func HandleEvents(rw http.ResponseWriter, req *http.Request) {
 	if len(topic) > 0 {
 		eventName = topic[0]
 	}
-	if !Config.Production {
-		log.Printf("Requested topic: %s", eventName)
-	}
+	LogFrom(req.Context()).Debug("events requested", "component", "sse", "topic", eventName)
 	header := rw.Header()
 	header.Set("Content-Type", "text/event-stream")
 	header.Set("Cache-Control", "no-cache")
@@ -86,20 +86,18 @@ func (broker *Broker) listen() {
 		select {
 		case s := <-broker.newClients:
 			broker.clients[s] = struct{}{}
-			if !Config.Production {
-				log.Printf("Client added. %d registered clients", len(broker.clients))
-			}
+			SSEClients.Set(float64(len(broker.clients)))
+			sseLog.Debug("client added", "clients", len(broker.clients))
 		case s := <-broker.closingClients:
 			delete(broker.clients, s)
-			if !Config.Production {
-				log.Printf("Removed client. %d registered clients", len(broker.clients))
-			}
+			SSEClients.Set(float64(len(broker.clients)))
+			sseLog.Debug("client removed", "clients", len(broker.clients))
 		case event := <-broker.Notifier:
 			for clientMessageChan := range broker.clients {
 				select {
 				case clientMessageChan <- event:
 				case <-time.After(patience):
-					log.Printf("Skipping client %s", event.EventName)
+					sseLog.Warn("skipping slow client", "event", event.EventName)
 				}
 			}
 		}
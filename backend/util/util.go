@@ -1,7 +1,9 @@
 package util
 
 import (
+	crand "crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,16 +13,16 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 )
 
 var (
-	lastPriceUpdate time.Time
-	XmrPrice        uint64
-	alphaNums       = []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+	alphaNums = []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+
+	// httpClient is for the exchange apis, a source that hangs shouldn't hold up the others
+	httpClient = &http.Client{Timeout: time.Second * 15}
 )
 
 var (
@@ -74,10 +76,14 @@ func NoRows(err error) bool {
 }
 
 func GetURL(url string, dst interface{}) error {
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		return fmt.Errorf("GetURL: error %v", err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GetURL: status %d", resp.StatusCode)
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -91,61 +97,14 @@ func GetURL(url string, dst interface{}) error {
 	return nil
 }
 
-func PriceMarket(market string) (float64, error) {
-	type response struct {
-		Success bool   `json:"success"`
-		Price   string `json:"price"`
-	}
-	resp := &response{}
-	if err := GetURL("https://tradeogre.com/api/v1/ticker/"+market, resp); err != nil {
-		return 0, err
-	}
-	if !resp.Success {
-		return 0, fmt.Errorf("PriceMarket: failed to get %s", market)
-	}
-	price, err := strconv.ParseFloat(resp.Price, 64)
-	if err != nil {
-		return 0, fmt.Errorf("PriceMarket: parseFloat error %v", err)
-	}
-	return price, nil
+// CalcEntryFromFiat is the piconero of a ticket costing ticketPrice at the xmrRate of the same currency
+func CalcEntryFromFiat(ticketPrice float64, xmrRate uint64) uint64 {
+	rate := (float64(xmrRate) / 100000000)
+	return uint64((ticketPrice / rate) * 1e12)
 }
 
-func XmrToUSD(force bool) (uint64, error) {
-	if !force && XmrPrice > 0 && time.Since(lastPriceUpdate).Minutes() <= 5 {
-		return XmrPrice, nil
-	}
-	var (
-		wg             sync.WaitGroup
-		btcUSD, xmrBTC float64
-		errBTC, errXMR error
-	)
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		btcUSD, errBTC = PriceMarket("BTC-USDT")
-	}()
-	go func() {
-		defer wg.Done()
-		xmrBTC, errXMR = PriceMarket("XMR-BTC")
-	}()
-	wg.Wait()
-	if errBTC != nil {
-		return 0, fmt.Errorf("XmrToUSD btc price error %v", errBTC)
-	}
-	if errXMR != nil {
-		return 0, fmt.Errorf("XmrToUSD xmr price error %v", errXMR)
-	}
-	XmrPrice = uint64(btcUSD * xmrBTC * 100000000)
-	return XmrPrice, nil
-}
-
-func CalcEntryFromUSD(xmrUSDPrice uint64) uint64 {
-	usd := (float64(xmrUSDPrice) / 100000000)
-	return uint64((2.5 / usd) * 1e12)
-}
-
-func USDToDecimal(usd uint64) string {
-	str0 := fmt.Sprintf("%09d", usd)
+func FiatToDecimal(amount uint64) string {
+	str0 := fmt.Sprintf("%09d", amount)
 	l := len(str0)
 	return str0[:l-8] + "." + str0[l-8:]
 }
@@ -190,3 +149,18 @@ func SignEntry(id int64, key string) string {
 	s256.Write([]byte(key + strconv.FormatInt(id, 10)))
 	return fmt.Sprintf("%x", s256.Sum(nil))
 }
+
+// NewSeed returns a random hex seed used as the next round sign key
+func NewSeed() (string, error) {
+	b := make([]byte, 32)
+	if _, err := crand.Read(b); err != nil {
+		return "", fmt.Errorf("NewSeed error %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Commitment is the published sha256 of a seed, revealed after the draw
+func Commitment(seed string) string {
+	s256 := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(s256[:])
+}
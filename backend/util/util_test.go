@@ -7,8 +7,8 @@ import (
 	"testing"
 )
 
-func TestXmrToUSD(t *testing.T) {
-	price, err := XmrToUSD(true)
+func TestXmrToFiat(t *testing.T) {
+	price, err := XmrToFiat(true)
 	if err != nil {
 		t.Errorf("Wanted no error, got error %v", err)
 	}
@@ -93,3 +93,32 @@ func TestHashMatch(t *testing.T) {
 	}
 	// t.Errorf("m1: %v\n m2: %v", m1, m2)
 }
+
+func TestSplitParse(t *testing.T) {
+	tables := []struct {
+		split Split
+		tiers string
+		err   bool
+		count int
+	}{
+		{Split{Winner: 70, Referrals: 15, Maintenance: 10, Fund: 5}, "", false, 1},
+		{Split{Winner: 70, Referrals: 15, Maintenance: 10, Fund: 5}, "50,15,5", false, 3},
+		{Split{Winner: 70, Referrals: 15, Maintenance: 10, Fund: 5}, "50,15", true, 0},
+		{Split{Winner: 80, Referrals: 0, Maintenance: 10, Fund: 10}, "", false, 1},
+		{Split{Winner: 80, Referrals: 15, Maintenance: 10, Fund: 5}, "", true, 0},
+		{Split{Winner: 70, Referrals: 15, Maintenance: 10, Fund: 5}, "70,-1", true, 0},
+		{Split{Winner: 70, Referrals: 15, Maintenance: 15, Fund: 0}, "70,0", false, 2},
+		{Split{Winner: 70, Referrals: 30, Maintenance: 0, Fund: 0}, "", false, 1},
+		{Split{Winner: 70, Referrals: 15, Maintenance: 15, Fund: 0}, "60,0", true, 0},
+	}
+	for _, table := range tables {
+		s := table.split
+		err := s.parse(table.tiers)
+		if (err != nil) != table.err {
+			t.Errorf("Wanted error %v for %v %s got %v", table.err, table.split, table.tiers, err)
+		}
+		if err == nil && len(s.Tiers) != table.count {
+			t.Errorf("Wanted %d tiers got %v", table.count, s.Tiers)
+		}
+	}
+}
@@ -6,13 +6,15 @@ const eventBus = mitt();
 const app = createApp(App);
 app.config.globalProperties.eventBus = eventBus;
 app.config.globalProperties.appUtil = {
-    toUsd(rate, value) {
-        return (
-            "$" +
-            (Number(rate) * Number(value))
-                .toFixed(2)
-                .replace(/\B(?=(\d{3})+(?!\d))/g, ",")
-        );
+    toFiat(rate, value, currency) {
+        // a fixed entry price in XMR has no fiat rate
+        if (!rate) {
+            return "";
+        }
+        return new Intl.NumberFormat(undefined, {
+            style: "currency",
+            currency: currency || "USD",
+        }).format(Number(rate) * Number(value));
     },
 };
 app.mount('#app')